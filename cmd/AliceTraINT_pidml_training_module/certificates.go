@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+)
+
+// certificateExpiryWarning is how long before expiry of a certificate the
+// module starts warning about it.
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// checkCertificates reports expiry of configured certificates and of
+// certificates presented by web interfaces of servers. Problems are only
+// logged, the connection itself fails later if the certificates are not
+// valid.
+func checkCertificates(ctx context.Context, servers []*server, certs []client.CertificateInfo) {
+	for _, srv := range servers {
+		serverCerts, err := srv.client.ServerCertificates(ctx)
+		if err != nil {
+			log.Printf("Cannot check certificates of web interface %s. Error text: %s", srv.profile.Name, err.Error())
+		}
+		certs = append(certs, serverCerts...)
+	}
+
+	now := time.Now()
+	for _, cert := range certs {
+		left := cert.NotAfter.Sub(now)
+		switch {
+		case left <= 0:
+			log.Printf("ERROR: %s %s expired on %s", cert.Source, cert.Subject, cert.NotAfter.Format(time.DateOnly))
+		case left < certificateExpiryWarning:
+			log.Printf("WARNING: %s %s expires on %s, in %d days", cert.Source, cert.Subject, cert.NotAfter.Format(time.DateOnly), int(left.Hours()/24))
+		default:
+			log.Printf("%s %s valid until %s", cert.Source, cert.Subject, cert.NotAfter.Format(time.DateOnly))
+		}
+	}
+}
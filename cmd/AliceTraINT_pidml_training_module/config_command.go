@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+// runConfigCommand runs config subcommand. `config print [flags]` writes
+// effective configuration with secrets redacted, merged from the same layers
+// as when the module is started with the same flags.
+func runConfigCommand(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		log.Fatal("usage: AliceTraINT_pidml_training_module config print [flags]")
+	}
+
+	cfg, err := config.Load(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = cfg.Print(os.Stdout)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+// handshake sends inventory of the machine to web interface of server
+// profile and checks that its API is compatible with the module. onFailure is
+// called after every failed attempt.
+func handshake(ctx context.Context, c *client.Client, cfg *config.Config, profile config.ServerProfile, inventory *client.MachineInventory, onFailure func()) error {
+	var resp *client.HandshakeResponse
+	err := retry(ctx, cfg, "send machine inventory", func() error {
+		var err error
+		resp, err = c.Handshake(ctx, inventory)
+		if err != nil {
+			onFailure()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("handshake with web interface %s failed: %w", profile.Name, err)
+	}
+
+	err = client.CheckAPIVersion(resp.APIVersion)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Connected to web interface %s with API version %s", profile, resp.APIVersion)
+	return nil
+}
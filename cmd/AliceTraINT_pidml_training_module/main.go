@@ -1,40 +1,112 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
-	"fmt"
 
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/backoff"
 	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
 	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/logging"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/machine"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/pipeline"
 	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/tasksource"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/training"
 )
 
-func runCommands(commands []scripts.Command, ttId uint) error {
-	for _, command := range commands {
-		err := command.Run()
+// retry calls fn until it succeeds or fails with error other than transient
+// error of web interface, waiting with exponential backoff between attempts.
+func retry(ctx context.Context, cfg *config.Config, action string, fn func() error) error {
+	bo := backoff.New(time.Second, time.Duration(cfg.MaxBackoffSeconds)*time.Second)
+	for {
+		err := fn()
+		if err == nil || !client.IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		wait := bo.Next()
+		log.Printf("Failed to %s, web interface unavailable, retrying in %s. Error text: %s", action, wait.Round(time.Millisecond), err.Error())
+		err = backoff.Sleep(ctx, wait)
 		if err != nil {
-			command.UploadLogs(ttId)
 			return err
 		}
-		command.UploadLogs(ttId)
-		command.UploadResults(ttId)
 	}
+}
 
-	return nil
+// reportOutcome journals final status of finished task in the spool. State
+// of the task is removed only after that, so the outcome is not lost if the
+// module is restarted meanwhile.
+func reportOutcome(ctx context.Context, out *spool.Spool, state *pipeline.TaskState) error {
+	log.Printf("Training Task of id %d, reporting status %s", state.Task.ID, state.Outcome.Status)
+	err := state.ReportOutcome(ctx, out)
+	if err != nil {
+		return err
+	}
+
+	return state.Remove()
 }
 
-func handleError(cfg *config.Config, err error, ttId uint) {
-	log.Printf("Training Task of id %d, error occured, setting status to failed. Error text: %s", ttId, err.Error())
-	err = client.UpdateTaskStatus(cfg, ttId, client.Failed)
+// handleShutdown reports training task interrupted by shutdown request. Task
+// is requeued if the web interface allows it, so it is resumed from its state
+// after restart, otherwise it is marked as failed. Its status updates still
+// waiting in the spool are dropped, so they cannot override the new status.
+func handleShutdown(ctx context.Context, c *client.Client, out *spool.Spool, cfg *config.Config, state *pipeline.TaskState) {
+	ctx, cancel := pipeline.CleanupContext(ctx, cfg)
+	defer cancel()
+
+	ttId := state.Task.ID
+	out.Discard(ttId, spool.EntryStatus)
+	log.Printf("Training Task of id %d, interrupted by shutdown, requeueing", ttId)
+	err := c.UpdateTaskStatus(ctx, ttId, client.Queued)
+	if err == nil {
+		return
+	}
+
+	log.Printf("Training Task of id %d, cannot requeue, setting status to failed. Error text: %s", ttId, err.Error())
+	err = c.UpdateTaskStatusWithPayload(ctx, ttId, &client.UpdateTaskStatusPayload{
+		Status: client.Failed,
+		Failure: &client.FailureReport{
+			Class:   string(scripts.ErrorClassInterrupted),
+			Message: "interrupted by shutdown of training machine",
+		},
+	})
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Printf("Training Task of id %d, cannot set status to failed, keeping its state. Error text: %s", ttId, err.Error())
+		return
+	}
+
+	err = state.Remove()
+	if err != nil {
+		log.Print(err.Error())
 	}
 }
 
+// writeTrainingConfig validates configuration of training task and writes it
+// with defaults filled in for pdi scripts. Invalid configuration is reported
+// as failure of the task before any stage is run.
+func writeTrainingConfig(path string, tt *client.TrainingTaskResponse) error {
+	trainingCfg, err := training.Parse(tt.Configuration)
+	if err != nil {
+		return &pipeline.FailureError{Class: scripts.ErrorClassInvalidConfig, Err: err}
+	}
+
+	data, err := json.MarshalIndent(trainingCfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, os.ModePerm)
+}
+
 func removeContents(dir string) error {
 	d, err := os.Open(dir)
 	if err != nil {
@@ -54,82 +126,197 @@ func removeContents(dir string) error {
 	return nil
 }
 
+func cleanWorkspace(cfg *config.Config) error {
+	err := removeContents(cfg.DataDirPath)
+	if err != nil {
+		return err
+	}
+
+	return removeContents(cfg.ResultsDirPath)
+}
+
 func main() {
-	cfg := config.LoadConfig()
-	trainingConfigPath := filepath.Join(cfg.DataDirPath, "train.json")
-	preprocessedRoot := filepath.Join(cfg.DataDirPath, fmt.Sprintf("%s.root", scripts.PreprocessedAodFileName))
-	waitDuration := time.Duration(cfg.PoolingWaitSeconds) * time.Second
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfigCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "secrets" {
+		runSecretsCommand(os.Args[2:])
+		return
+	}
 
-	err := os.MkdirAll(cfg.DataDirPath, os.ModePerm)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// second signal terminates the module immediately
+	context.AfterFunc(ctx, stop)
+
+	cfg := config.LoadConfig()
+	level, err := logging.ParseLevel(cfg.LogLevel)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	logging.SetLevel(level)
 
-	err = os.MkdirAll(cfg.ResultsDirPath, os.ModePerm)
+	tlsConfig, certs, err := pipeline.LoadTLSConfig(cfg)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-
-	for {
-		err = removeContents(cfg.DataDirPath)
+	var servers []*server
+	serversByName := make(map[string]*server)
+	for _, profile := range cfg.Profiles() {
+		srv, err := newServer(ctx, cfg, profile, tlsConfig)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+		servers = append(servers, srv)
+		serversByName[profile.Name] = srv
+	}
+	checkCertificates(ctx, servers, certs)
+	trainingConfigPath := pipeline.TrainingConfigPath(cfg)
 
-		err = removeContents(cfg.ResultsDirPath)
-		if err != nil {
-			log.Fatal(err.Error())
-		}
+	p, err := pipeline.Load(cfg.PipelineFilePath)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
-		tt, err := client.GetQueuedTask(cfg)
+	for _, dir := range []string{cfg.DataDirPath, cfg.ResultsDirPath, cfg.StateDirPath} {
+		err = os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+	}
 
-		if tt == nil {
-			time.Sleep(waitDuration)
-			continue
-		}
+	inventory := machine.Collect(ctx, cfg, p)
+	log.Printf("Machine inventory: %d CPUs, %d MB RAM, %d MB free in data directory, %s, O2Physics %s, pdi %s",
+		inventory.CPUCount, inventory.MemoryBytes>>20, inventory.DataDirFreeBytes>>20, inventory.OS, inventory.O2PhysicsVersion, inventory.PdiCommit)
+	source := tasksource.NewPrioritized()
+	for _, srv := range servers {
+		go srv.start(cfg, inventory, source, servers)
+	}
 
-		jsonString, err := json.Marshal(tt.Configuration)
-		if err != nil {
-			handleError(cfg, err, tt.ID)
-			continue
-		}
-		os.WriteFile(trainingConfigPath, jsonString, os.ModePerm)
-
-		training_commands := []scripts.Command{
-			scripts.NewGridDownloadRunner(cfg, tt.AODFiles),
-			scripts.NewProducerRunner(cfg),
-			scripts.NewPdiRunner(scripts.PdiCommandProcess, cfg, preprocessedRoot, trainingConfigPath),
-			scripts.NewPdiRunner(scripts.PdiCommandDataExploration, cfg),
-			scripts.NewPdiRunner(scripts.PdiCommandTrain, cfg, trainingConfigPath),
+	var current *server
+	p.OnStage = func(ttId uint, stageName string) {
+		setActivity(servers, current, ttId, stageName)
+	}
+
+	reload := newReloader(config.DotenvPath, cfg.ConfigFilePath, cfg.PipelineFilePath)
+	go reload.Run(ctx)
+
+	for ctx.Err() == nil {
+		if reload.Take() {
+			reloadConfig(cfg, p, servers)
 		}
-		err = runCommands(training_commands, tt.ID)
+
+		ready, waiting := partitionReady(servers)
+		srv, state, err := resumableState(ready)
 		if err != nil {
-			handleError(cfg, err, tt.ID)
-			continue
+			log.Fatal(err.Error())
 		}
 
-		err = client.UpdateTaskStatus(cfg, tt.ID, client.Benchmarking)
-		if err != nil {
-			handleError(cfg, err, tt.ID)
-			continue
+		if state != nil {
+			log.Printf("Training Task of id %d, resuming from persisted state of %s", state.Task.ID, srv.profile.Name)
+		} else {
+			// workspace of interrupted tasks is kept until their servers
+			// connect or fail to, so they are not restarted needlessly
+			connecting, err := pendingServers(waiting, false)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			if len(connecting) > 0 {
+				waitSettled(ctx, connecting)
+				continue
+			}
+
+			pending, err := pendingServers(waiting, true)
+			if err == nil {
+				err = restartWaitingStates(waiting)
+			}
+			if err == nil {
+				err = cleanWorkspace(cfg)
+			}
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+
+			waitCtx, cancelWait := reload.WaitContext(ctx)
+			waitCtx, cancelResume := untilConnected(waitCtx, pending)
+			tt, name, err := source.Next(waitCtx)
+			interrupted := waitCtx.Err() != nil
+			cancelResume()
+			cancelWait()
+			if ctx.Err() != nil {
+				break
+			}
+			if interrupted && tt == nil {
+				continue
+			}
+			if errors.Is(err, client.ErrUnauthorized) {
+				serversByName[name].disable(err, source, servers)
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to get queued training task. Error text: %s", err.Error())
+			}
+
+			if tt == nil {
+				backoff.Sleep(ctx, time.Duration(cfg.PoolingWaitSeconds)*time.Second)
+				continue
+			}
+
+			srv = serversByName[name]
+			log.Printf("Training Task of id %d, received from %s", tt.ID, name)
+			state = pipeline.NewState(srv.stateDir, tt)
+			err = state.Save()
+			if err != nil {
+				log.Fatal(err.Error())
+			}
 		}
 
-		benchmarking_commands := []scripts.Command{
-			scripts.NewPdiRunner(scripts.PdiCommandBenchmark, cfg),
+		if !state.Finished() {
+			// workspace may have been wiped since the task was received, so
+			// training configuration is written before every run
+			err = writeTrainingConfig(trainingConfigPath, &state.Task)
+			if err != nil {
+				log.Printf("Training Task of id %d, cannot write training configuration. Error text: %s", state.Task.ID, err.Error())
+				state.Fail(err)
+				err = state.Save()
+				if err != nil {
+					log.Fatal(err.Error())
+				}
+			}
 		}
-		err = runCommands(benchmarking_commands, tt.ID)
-		if err != nil {
-			handleError(cfg, err, tt.ID)
-			continue
+
+		if !state.Finished() {
+			current = srv
+			err = p.Run(ctx, srv.client, srv.out, cfg, state)
+			setActivity(servers, nil, 0, "")
+			if err != nil && ctx.Err() != nil {
+				handleShutdown(ctx, srv.client, srv.out, cfg, state)
+				break
+			}
+			if errors.Is(err, pipeline.ErrTaskCancelled) {
+				log.Printf("Training Task of id %d, cancelled on web interface, cleaning workspace", state.Task.ID)
+				srv.out.Discard(state.Task.ID)
+				err = cleanWorkspace(cfg)
+				if err == nil {
+					err = state.Remove()
+				}
+				if err != nil {
+					log.Fatal(err.Error())
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("Training Task of id %d, error occured, setting status to failed. Error text: %s", state.Task.ID, err.Error())
+			}
 		}
 
-		err = client.UpdateTaskStatus(cfg, tt.ID, client.Completed)
+		err = reportOutcome(ctx, srv.out, state)
 		if err != nil {
-			handleError(cfg, err, tt.ID)
-			continue
+			log.Fatal(err.Error())
 		}
 	}
+
+	drainSpools(ctx, cfg, servers)
+	log.Print("Shutdown requested, exiting")
 }
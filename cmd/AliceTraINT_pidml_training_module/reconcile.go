@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/pipeline"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+)
+
+const interruptedByRestartMessage = "interrupted by machine restart"
+
+// reconcileOrphanedTasks brings training tasks left by previous run of the
+// module in sync with web interface. Active or requeued tasks with local state
+// are kept to be resumed, active tasks without it are marked as failed and
+// local states of tasks which are no longer active are removed. Tasks with
+// requests still waiting in the spool are left alone, their final status is
+// yet to be delivered.
+func reconcileOrphanedTasks(ctx context.Context, c *client.Client, out *spool.Spool, stateDir string) error {
+	statuses := append([]client.TrainingTaskStatus{client.Queued}, client.ActiveStatuses...)
+	tasks, err := c.GetAssignedTasks(ctx, statuses...)
+	if err != nil {
+		return err
+	}
+
+	localIds, err := pipeline.ListStates(stateDir)
+	if err != nil {
+		return err
+	}
+	hasState := make(map[uint]bool)
+	for _, id := range localIds {
+		hasState[id] = true
+	}
+
+	assigned := make(map[uint]bool)
+	for _, tt := range tasks {
+		assigned[tt.ID] = true
+
+		if hasState[tt.ID] {
+			log.Printf("Training Task of id %d, found local state, it will be resumed", tt.ID)
+			continue
+		}
+
+		if tt.Status == client.Queued {
+			continue
+		}
+
+		if out.Pending(tt.ID) {
+			log.Printf("Training Task of id %d, has undelivered requests in spool, leaving it", tt.ID)
+			continue
+		}
+
+		log.Printf("Training Task of id %d, orphaned in status %s, setting status to failed", tt.ID, tt.Status)
+		err = c.UpdateTaskStatusWithPayload(ctx, tt.ID, &client.UpdateTaskStatusPayload{
+			Status: client.Failed,
+			Failure: &client.FailureReport{
+				Class:   string(scripts.ErrorClassInterrupted),
+				Message: interruptedByRestartMessage,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range localIds {
+		if assigned[id] {
+			continue
+		}
+
+		log.Printf("Training Task of id %d, no longer active on web interface, removing its local state", id)
+		state, err := pipeline.LoadState(stateDir, id)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			continue
+		}
+
+		err = state.Remove()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
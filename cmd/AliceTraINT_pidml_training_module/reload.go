@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/logging"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/pipeline"
+)
+
+// reloadCheckInterval is how often modification times of configuration
+// files are checked.
+const reloadCheckInterval = 10 * time.Second
+
+// reloader requests reload of configuration on SIGHUP or when any of
+// watched files is modified.
+type reloader struct {
+	paths  []string
+	mtimes map[string]time.Time
+
+	mu        sync.Mutex
+	requested chan struct{}
+}
+
+func newReloader(paths ...string) *reloader {
+	r := &reloader{
+		mtimes:    make(map[string]time.Time),
+		requested: make(chan struct{}),
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		r.paths = append(r.paths, path)
+		r.mtimes[path] = modTime(path)
+	}
+
+	return r
+}
+
+// modTime returns modification time of the file, zero if it does not exist.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// Run watches for SIGHUP and changes of files until ctx is done.
+func (r *reloader) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(reloadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Print("SIGHUP received, configuration will be reloaded before next training task")
+			r.request()
+		case <-ticker.C:
+			for _, path := range r.paths {
+				mtime := modTime(path)
+				if !mtime.Equal(r.mtimes[path]) {
+					r.mtimes[path] = mtime
+					log.Printf("%s modified, configuration will be reloaded before next training task", path)
+					r.request()
+				}
+			}
+		}
+	}
+}
+
+func (r *reloader) request() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.requested:
+	default:
+		close(r.requested)
+	}
+}
+
+// Take reports whether reload was requested since the last call.
+func (r *reloader) Take() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.requested:
+		r.requested = make(chan struct{})
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitContext returns context of waiting for the next training task, it is
+// cancelled when reload is requested, so the reload is not delayed until a
+// task is queued.
+func (r *reloader) WaitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	r.mu.Lock()
+	requested := r.requested
+	r.mu.Unlock()
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-requested:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	return waitCtx, cancel
+}
+
+// reloadConfig applies reloadable changes of configuration and timeouts of
+// pipeline stages, it is called between training tasks. Changes are logged,
+// including those which need restart of the module.
+func reloadConfig(cfg *config.Config, p *pipeline.Pipeline, servers []*server) {
+	changes, err := cfg.Reload(os.Args[1:])
+	if err != nil {
+		log.Printf("Failed to reload configuration, keeping current one. Error text: %s", err.Error())
+	}
+	for _, change := range changes {
+		if change.Applied {
+			log.Printf("Configuration reloaded, %s", change)
+		} else {
+			log.Printf("Configuration change requires restart, ignored %s", change)
+		}
+	}
+	if err == nil && len(changes) == 0 {
+		log.Print("Configuration reloaded, no changes")
+	}
+
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err == nil {
+		logging.SetLevel(level)
+	}
+	for _, srv := range servers {
+		srv.source.SetPollInterval(time.Duration(cfg.PoolingWaitSeconds) * time.Second)
+	}
+
+	timeouts, ignored, err := p.ReloadTimeouts(cfg.PipelineFilePath)
+	if err != nil {
+		log.Printf("Failed to reload pipeline file, keeping current one. Error text: %s", err.Error())
+		return
+	}
+	for _, change := range timeouts {
+		log.Printf("Pipeline reloaded, %s", change)
+	}
+	if ignored {
+		log.Print("Pipeline change other than stage timeouts requires restart, ignored")
+	}
+}
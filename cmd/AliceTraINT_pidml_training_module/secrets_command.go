@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+const secretsUsage = "usage: AliceTraINT_pidml_training_module secrets [-config path] [-keystore path] [-passphrase-file path] list | set NAME [FILE] | delete NAME"
+
+// runSecretsCommand manages encrypted keystore of secrets provider. Keystore
+// path and passphrase are resolved from the same layers as when the module
+// is started, -keystore and -passphrase-file flags override them. Secret set
+// without FILE is read from standard input.
+func runSecretsCommand(args []string) {
+	flagSet := flag.NewFlagSet("secrets", flag.ExitOnError)
+	configPath := flagSet.String("config", "", "path of JSON config file, overrides "+config.ConfigFileEnv)
+	keystorePath := flagSet.String("keystore", "", "path of keystore, overrides ALICETRAINT_KEYSTORE_PATH")
+	passphrasePath := flagSet.String("passphrase-file", "", "path of file with keystore passphrase, overrides ALICETRAINT_KEYSTORE_PASSPHRASE and ALICETRAINT_KEYSTORE_PASSPHRASE_PATH")
+	flagSet.Parse(args)
+	args = flagSet.Args()
+	if len(args) == 0 {
+		log.Fatal(secretsUsage)
+	}
+
+	var loadArgs []string
+	if *configPath != "" {
+		loadArgs = []string{"-config", *configPath}
+	}
+	cfg, err := config.LoadWithoutProfiles(loadArgs)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if *keystorePath != "" {
+		cfg.KeystorePath = *keystorePath
+	}
+	if *passphrasePath != "" {
+		cfg.KeystorePassphrase = ""
+		cfg.KeystorePassphrasePath = *passphrasePath
+	}
+
+	ks, err := cfg.OpenKeystore()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		for _, name := range ks.Names() {
+			fmt.Println(name)
+		}
+		return
+	case args[0] == "set" && (len(args) == 2 || len(args) == 3):
+		var secret []byte
+		if len(args) == 3 {
+			secret, err = os.ReadFile(args[2])
+		} else {
+			secret, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		ks.Set(args[1], secret)
+	case args[0] == "delete" && len(args) == 2:
+		ks.Delete(args[1])
+	default:
+		log.Fatal(secretsUsage)
+	}
+
+	err = ks.Save()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/machine"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/pipeline"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/tasksource"
+)
+
+// server is web interface of a server profile with everything the module
+// keeps separately for it: client, spool, heartbeat and states of its tasks.
+// Results of a task always go back to the server which issued it.
+type server struct {
+	profile   config.ServerProfile
+	client    *client.Client
+	out       *spool.Spool
+	heartbeat *machine.Heartbeat
+	source    tasksource.TaskSource
+	stateDir  string
+	ready     atomic.Bool
+	disabled  atomic.Bool
+
+	// connected is closed when the server becomes ready, settled also when
+	// its first connection attempt fails or it is disabled
+	connected   chan struct{}
+	settled     chan struct{}
+	connectOnce sync.Once
+	settleOnce  sync.Once
+
+	// ctx of background work for the server, cancelled when it is disabled
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newServer(ctx context.Context, cfg *config.Config, profile config.ServerProfile, tlsConfig *tls.Config) (*server, error) {
+	c, err := pipeline.NewClient(cfg, profile, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	stateDir := pipeline.StateDir(cfg, profile)
+	err = os.MkdirAll(stateDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := spool.New(profile.Dir(cfg.SpoolDirPath), c, time.Duration(cfg.MaxBackoffSeconds)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	// spool removes orphaned artifacts, so states of their uploads are
+	// removed only after it is opened
+	err = c.RemoveStaleUploads()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	source, err := tasksource.New(ctx, cfg, c)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &server{
+		profile:   profile,
+		client:    c,
+		out:       out,
+		heartbeat: machine.NewHeartbeat(c, time.Duration(cfg.HeartbeatSeconds)*time.Second, cfg.DataDirPath),
+		source:    source,
+		stateDir:  stateDir,
+		connected: make(chan struct{}),
+		settled:   make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// start connects to web interface of the server, reconciles tasks left by
+// previous run of the module and adds task source of the server to source.
+// The server is disabled if web interface rejects credentials of the machine
+// or its API is not compatible.
+func (s *server) start(cfg *config.Config, inventory *client.MachineInventory, source *tasksource.Prioritized, servers []*server) {
+	go s.out.Run(s.ctx)
+
+	err := handshake(s.ctx, s.client, cfg, s.profile, inventory, s.settle)
+	if s.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.disable(err, source, servers)
+		return
+	}
+
+	go s.heartbeat.Run(s.ctx)
+
+	err = retry(s.ctx, cfg, "reconcile orphaned training tasks", func() error {
+		return reconcileOrphanedTasks(s.ctx, s.client, s.out, s.stateDir)
+	})
+	if s.ctx.Err() != nil {
+		return
+	}
+	if errors.Is(err, client.ErrUnauthorized) {
+		s.disable(err, source, servers)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reconcile orphaned training tasks of %s. Error text: %s", s.profile.Name, err.Error())
+	}
+
+	s.ready.Store(true)
+	source.Add(s.profile.Name, s.profile.Priority, s.source)
+	s.connectOnce.Do(func() { close(s.connected) })
+	s.settle()
+}
+
+func (s *server) settle() {
+	s.settleOnce.Do(func() { close(s.settled) })
+}
+
+// disable stops all work for the server, whose web interface rejected the
+// machine, other servers are still served. The module exits when no server
+// is left. Tasks of the server persisted in state directory and requests
+// left in its spool are kept until restart of the module.
+func (s *server) disable(err error, source *tasksource.Prioritized, servers []*server) {
+	if s.disabled.Swap(true) {
+		return
+	}
+	log.Printf("Web interface %s disabled until restart. Error text: %s", s.profile.Name, err.Error())
+	s.ready.Store(false)
+	source.Remove(s.profile.Name)
+	s.cancel()
+	s.settle()
+
+	for _, srv := range servers {
+		if !srv.disabled.Load() {
+			return
+		}
+	}
+	log.Fatal("No usable web interface left, exiting")
+}
+
+// partitionReady splits servers to those which are ready and those which are
+// not, at a single moment, so a server becoming ready meanwhile is not
+// missed by both.
+func partitionReady(servers []*server) (ready, waiting []*server) {
+	for _, srv := range servers {
+		if srv.ready.Load() {
+			ready = append(ready, srv)
+		} else {
+			waiting = append(waiting, srv)
+		}
+	}
+
+	return ready, waiting
+}
+
+// resumableState returns persisted state of training task interrupted by
+// the module restart and server which issued it. Only ready servers should
+// be given, so server which is not connected yet does not block tasks of the
+// others.
+func resumableState(ready []*server) (*server, *pipeline.TaskState, error) {
+	for _, srv := range ready {
+		ids, err := pipeline.ListStates(srv.stateDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		state, err := pipeline.LoadState(srv.stateDir, ids[0])
+		if err != nil || state == nil {
+			return nil, nil, err
+		}
+
+		return srv, state, nil
+	}
+
+	return nil, nil, nil
+}
+
+// pendingServers returns servers which have persisted tasks and may still
+// become ready, settled false selects only those whose first connection
+// attempt is still in progress.
+func pendingServers(waiting []*server, settled bool) ([]*server, error) {
+	var pending []*server
+	for _, srv := range waiting {
+		if srv.disabled.Load() || !settled && isClosed(srv.settled) {
+			continue
+		}
+		ids, err := pipeline.ListStates(srv.stateDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			pending = append(pending, srv)
+		}
+	}
+
+	return pending, nil
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitSettled waits until any of servers becomes ready or fails to connect.
+func waitSettled(ctx context.Context, servers []*server) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, srv := range servers {
+		go func() {
+			select {
+			case <-srv.settled:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	<-ctx.Done()
+}
+
+// untilConnected returns ctx cancelled also when any of servers becomes
+// ready, so its persisted tasks are resumed before a new task is taken.
+func untilConnected(ctx context.Context, servers []*server) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	for _, srv := range servers {
+		go func() {
+			select {
+			case <-srv.connected:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return ctx, cancel
+}
+
+// restartWaitingStates clears progress of unfinished tasks persisted for
+// servers which are not ready, before the workspace is wiped for task of
+// another server. Such tasks are run from the first stage once their server
+// is ready.
+func restartWaitingStates(waiting []*server) error {
+	for _, srv := range waiting {
+		ids, err := pipeline.ListStates(srv.stateDir)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			state, err := pipeline.LoadState(srv.stateDir, id)
+			if err != nil {
+				return err
+			}
+			if state == nil || state.Finished() || len(state.Stages) == 0 {
+				continue
+			}
+
+			log.Printf("Training Task of id %d, web interface %s is not connected, workspace of the task is wiped and it will be run again from the first stage", id, srv.profile.Name)
+			err = state.Restart()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setActivity records training task and its stage in heartbeats. Details of
+// the task are reported only to the server which issued it, the others are
+// told just that the machine is busy. Nil current means the machine is idle.
+func setActivity(servers []*server, current *server, ttId uint, stage string) {
+	for _, srv := range servers {
+		if srv == current {
+			srv.heartbeat.SetActivity(ttId, stage)
+			continue
+		}
+		srv.heartbeat.SetActivity(0, "")
+		srv.heartbeat.SetBusy(current != nil)
+	}
+}
+
+// drainSpools delivers requests left in spools of all servers on shutdown,
+// e.g. partial logs of interrupted task, bounded by shutdown grace period.
+func drainSpools(ctx context.Context, cfg *config.Config, servers []*server) {
+	ctx, cancel := pipeline.CleanupContext(ctx, cfg)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		if srv.disabled.Load() || srv.out.Idle() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := srv.out.Drain(ctx)
+			if err != nil {
+				log.Printf("Failed to deliver spooled requests to %s before exiting, they are kept until restart. Error text: %s", srv.profile.Name, err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+}
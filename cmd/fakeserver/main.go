@@ -0,0 +1,341 @@
+// Command fakeserver is a minimal local stand-in for AliceTraINT web
+// interface, useful for testing the module without the real server. Tasks
+// are queued by POST /fake/tasks with training task JSON and announced to
+// connected machines through Server-Sent Events stream.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+)
+
+const keepAliveInterval = 30 * time.Second
+
+type server struct {
+	uploadsDir string
+	apiVersion string
+
+	mu          sync.Mutex
+	nextID      uint
+	tasks       map[uint]*client.TrainingTaskResponse
+	queue       []uint
+	subscribers map[chan uint]bool
+}
+
+func newServer(uploadsDir, apiVersion string) *server {
+	return &server{
+		uploadsDir:  uploadsDir,
+		apiVersion:  apiVersion,
+		nextID:      1,
+		tasks:       make(map[uint]*client.TrainingTaskResponse),
+		subscribers: make(map[chan uint]bool),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func pathID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	return uint(id), err
+}
+
+// queueTask queues task from request body and announces it to subscribers.
+func (s *server) queueTask(w http.ResponseWriter, r *http.Request) {
+	var tt client.TrainingTaskResponse
+	err := json.NewDecoder(r.Body).Decode(&tt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	tt.ID = s.nextID
+	tt.Status = client.Queued
+	s.nextID++
+	s.tasks[tt.ID] = &tt
+	s.queue = append(s.queue, tt.ID)
+	for sub := range s.subscribers {
+		select {
+		case sub <- tt.ID:
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	log.Printf("Queued training task %d", tt.ID)
+	writeJSON(w, http.StatusCreated, &tt)
+}
+
+func (s *server) getQueuedTask(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) > 0 {
+		tt := s.tasks[s.queue[0]]
+		s.queue = s.queue[1:]
+		if tt.Status != client.Queued {
+			continue
+		}
+
+		tt.Status = client.Training
+		log.Printf("Assigned training task %d", tt.ID)
+		writeJSON(w, http.StatusOK, tt)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *server) getAssignedTasks(w http.ResponseWriter, r *http.Request) {
+	statuses := make(map[string]bool)
+	for _, status := range r.URL.Query()["status"] {
+		statuses[status] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := []client.TrainingTaskResponse{}
+	for _, tt := range s.tasks {
+		if tt.Status != client.Queued && statuses[strconv.FormatUint(uint64(tt.Status), 10)] {
+			tasks = append(tasks, *tt)
+		}
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+// taskEvents streams task-queued events with id of the queued task,
+// keep-alive comments are sent in between.
+func (s *server) taskEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := make(chan uint, 1)
+	s.mu.Lock()
+	s.subscribers[sub] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, sub)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	log.Printf("Machine %s subscribed to task events, last event id %q", r.PathValue("id"), r.Header.Get("Last-Event-ID"))
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ttId := <-sub:
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {}\n\n", ttId, client.TaskEventQueued)
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *server) getTaskStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tt, ok := s.tasks[id]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, &client.TaskStatusResponse{Status: tt.Status})
+}
+
+func (s *server) updateTaskStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var payload client.UpdateTaskStatusPayload
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tt, ok := s.tasks[id]
+	if !ok {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	tt.Status = payload.Status
+	if payload.Status == client.Queued {
+		s.queue = append(s.queue, id)
+	}
+	log.Printf("Training task %d status %s %s", id, payload.Status, payload.Message)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *server) handshake(w http.ResponseWriter, r *http.Request) {
+	var inventory client.MachineInventory
+	err := json.NewDecoder(r.Body).Decode(&inventory)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Machine %s connected: %d CPUs, %s, stages %v", r.PathValue("id"), inventory.CPUCount, inventory.OS, inventory.PipelineStages)
+	writeJSON(w, http.StatusOK, &client.HandshakeResponse{APIVersion: s.apiVersion})
+}
+
+func (s *server) heartbeat(w http.ResponseWriter, r *http.Request) {
+	var heartbeat client.HeartbeatPayload
+	err := json.NewDecoder(r.Body).Decode(&heartbeat)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Machine %s heartbeat: busy %t, task %d, stage %q, load %.2f", r.PathValue("id"), heartbeat.Busy, heartbeat.TaskID, heartbeat.Stage, heartbeat.LoadAverage[0])
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadTaskResult stores uploaded file and echoes its checksum and size.
+func (s *server) uploadTaskResult(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	defer file.Close()
+
+	dir := filepath.Join(s.uploadsDir, strconv.FormatUint(uint64(id), 10))
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out, err := os.Create(filepath.Join(dir, filepath.Base(r.FormValue("name"))))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if expected := r.FormValue("sha256"); expected != "" && expected != checksum {
+		http.Error(w, "checksum mismatch", http.StatusUnprocessableEntity)
+		return
+	}
+
+	log.Printf("Training task %d result %s uploaded (%d bytes)", id, r.FormValue("name"), size)
+	writeJSON(w, http.StatusCreated, &client.TaskResultResponse{
+		ID:     id,
+		SHA256: checksum,
+		Size:   size,
+	})
+}
+
+// authenticate rejects requests of machines without valid secret or
+// signature, if secret is set. /fake endpoints are not authenticated.
+func authenticate(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret == "" || strings.HasPrefix(r.URL.Path, "/fake/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get(client.SignatureHeader) != "" {
+			err := client.VerifySignature(r, secret, client.DefaultSignatureWindow, time.Now())
+			if err != nil {
+				log.Printf("Rejected %s %s: %s", r.Method, r.URL, err.Error())
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		} else if r.Header.Get(client.SecretIdHeader) != secret {
+			log.Printf("Rejected %s %s: invalid secret", r.Method, r.URL)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	uploadsDir := flag.String("uploads", "fake_uploads", "directory for uploaded task results")
+	events := flag.Bool("events", true, "serve task events stream")
+	apiVersion := flag.String("api-version", fmt.Sprintf("%d.0", client.APIMajorVersion), "API version reported in handshake")
+	secret := flag.String("secret", "", "machine secret, requests are not authenticated if empty")
+	flag.Parse()
+
+	s := newServer(*uploadsDir, *apiVersion)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /fake/tasks", s.queueTask)
+	mux.HandleFunc("POST /training-machines/{id}/handshake", s.handshake)
+	mux.HandleFunc("POST /training-machines/{id}/heartbeat", s.heartbeat)
+	mux.HandleFunc("GET /training-machines/{id}/training-task", s.getQueuedTask)
+	mux.HandleFunc("GET /training-machines/{id}/training-tasks", s.getAssignedTasks)
+	if *events {
+		mux.HandleFunc("GET /training-machines/{id}/training-tasks/events", s.taskEvents)
+	}
+	mux.HandleFunc("GET /training-tasks/{id}/status", s.getTaskStatus)
+	mux.HandleFunc("POST /training-tasks/{id}/status", s.updateTaskStatus)
+	mux.HandleFunc("POST /training-tasks/{id}/training-task-results", s.uploadTaskResult)
+
+	log.Printf("Fake web interface listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, authenticate(*secret, mux)))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -10,9 +11,10 @@ import (
 
 	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
 	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/pipeline"
 )
 
-func uploadRecursiveWalkForExtension(rootDir, extension string, cfg *config.Config, ttId uint) {
+func uploadRecursiveWalkForExtension(ctx context.Context, rootDir, extension string, c *client.Client, ttId uint) {
 	err := filepath.WalkDir(rootDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			fmt.Println("Error accessing path:", err)
@@ -37,7 +39,7 @@ func uploadRecursiveWalkForExtension(rootDir, extension string, cfg *config.Conf
 					Type:        resultType,
 					FilePath:    path,
 				}
-				client.UploadTaskResult(cfg, ttId, &payload)
+				c.UploadTaskResult(ctx, ttId, &payload)
 			}
 		}
 		return nil
@@ -49,14 +51,25 @@ func uploadRecursiveWalkForExtension(rootDir, extension string, cfg *config.Conf
 }
 
 func main() {
+	ctx := context.Background()
 	cfg := config.LoadConfig()
+	// mock serves only the server profile of the highest priority
+	profile := cfg.Profiles()[0]
+	tlsConfig, _, err := pipeline.LoadTLSConfig(cfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	c, err := pipeline.NewClient(cfg, profile, tlsConfig)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
 	// Mock loop
 	for {
 		duration := 5 * time.Second
 		time.Sleep(duration)
 
-		ttr, err := client.GetQueuedTask(cfg)
+		ttr, err := c.GetQueuedTask(ctx)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
@@ -67,18 +80,18 @@ func main() {
 
 		time.Sleep(duration)
 
-		uploadRecursiveWalkForExtension("mock_uploads/models", ".onnx", cfg, ttr.ID)
+		uploadRecursiveWalkForExtension(ctx, "mock_uploads/models", ".onnx", c, ttr.ID)
 
-		err = client.UpdateTaskStatus(cfg, ttr.ID, client.Benchmarking)
+		err = c.UpdateTaskStatus(ctx, ttr.ID, client.Benchmarking)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
 
 		time.Sleep(duration)
 
-		uploadRecursiveWalkForExtension("mock_uploads/graphs", ".png", cfg, ttr.ID)
+		uploadRecursiveWalkForExtension(ctx, "mock_uploads/graphs", ".png", c, ttr.ID)
 
-		err = client.UpdateTaskStatus(cfg, ttr.ID, client.Completed)
+		err = c.UpdateTaskStatus(ctx, ttr.ID, client.Completed)
 		if err != nil {
 			log.Fatal(err.Error())
 		}
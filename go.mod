@@ -2,4 +2,7 @@ module github.com/mytkom/AliceTraINT_pidml_training_module
 
 go 1.22.1
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/crypto v0.31.0
+)
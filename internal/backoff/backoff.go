@@ -0,0 +1,57 @@
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between retries with full
+// jitter, so machines do not hit a recovering server at the same moment.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+
+	attempt int
+}
+
+func New(initial, max time.Duration) *Backoff {
+	return &Backoff{
+		Initial: initial,
+		Max:     max,
+	}
+}
+
+// Next returns delay before the next retry.
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.Max
+	if b.attempt < 32 {
+		if exp := b.Initial << b.attempt; exp > 0 && exp < b.Max {
+			ceiling = exp
+		}
+	}
+	b.attempt++
+	if ceiling <= 0 {
+		return b.Initial
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
+
+// Sleep waits for given duration, it returns earlier with ctx error if ctx is
+// done meanwhile.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,437 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// errChunkedUnsupported is returned when web interface does not support
+// chunked uploads, single multipart request is used instead.
+var errChunkedUnsupported = errors.New("chunked uploads not supported by web interface")
+
+// maxStalledResyncs limits consecutive chunks rejected as conflicting with
+// offset on web interface, after which the upload does not progress.
+const maxStalledResyncs = 3
+
+// UploadSessionPayload starts chunked upload of task result.
+type UploadSessionPayload struct {
+	Name        string
+	Type        TaskResultType
+	Description string
+	Size        int64
+}
+
+// UploadSessionResponse describes chunked upload on web interface. Offset is
+// number of bytes already received by the server, ChunkSize is size of chunks
+// requested by the server (zero if it accepts any).
+type UploadSessionResponse struct {
+	ID        string
+	Offset    int64
+	ChunkSize int64
+}
+
+// FinalizeUploadPayload finishes chunked upload, the server verifies the
+// received file against the checksum.
+type FinalizeUploadPayload struct {
+	Size   int64
+	SHA256 string
+}
+
+// uploadState is persisted progress of chunked upload of a single file,
+// which allows to continue the upload after it was interrupted.
+type uploadState struct {
+	UploadID  string
+	TaskID    uint
+	FilePath  string
+	Size      int64
+	ModTime   time.Time
+	SHA256    string
+	ChunkSize int64
+	Offset    int64
+}
+
+func (c *Client) uploadStatePath(ttId uint, filePath string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", ttId, filePath)))
+	return filepath.Join(c.uploadStateDir, fmt.Sprintf("upload-%s.json", hex.EncodeToString(sum[:8])))
+}
+
+// loadUploadState returns state of interrupted upload of the file, nil if
+// there is none or the file changed since.
+func (c *Client) loadUploadState(ttId uint, filePath string, info os.FileInfo) *uploadState {
+	data, err := os.ReadFile(c.uploadStatePath(ttId, filePath))
+	if err != nil {
+		return nil
+	}
+
+	var state uploadState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		log.Printf("Ignoring corrupted upload state of %s: %s", filePath, err.Error())
+		return nil
+	}
+
+	if state.TaskID != ttId || state.FilePath != filePath || state.Size != info.Size() || !state.ModTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	return &state
+}
+
+func (c *Client) saveUploadState(state *uploadState) error {
+	err := os.MkdirAll(c.uploadStateDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create upload state directory: %w", err)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload state: %w", err)
+	}
+
+	path := c.uploadStatePath(state.TaskID, state.FilePath)
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (c *Client) removeUploadState(state *uploadState) {
+	err := os.Remove(c.uploadStatePath(state.TaskID, state.FilePath))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove upload state of %s: %s", state.FilePath, err.Error())
+	}
+}
+
+// RemoveStaleUploads removes saved states of uploads which cannot be
+// continued, because their file was removed or modified since, e.g. upload
+// of result dropped from the spool.
+func (c *Client) RemoveStaleUploads() error {
+	if c.uploadStateDir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(c.uploadStateDir, "upload-*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read upload state: %w", err)
+		}
+
+		var state uploadState
+		err = json.Unmarshal(data, &state)
+		if err == nil {
+			info, statErr := os.Stat(state.FilePath)
+			if statErr == nil && state.Size == info.Size() && state.ModTime.Equal(info.ModTime()) {
+				continue
+			}
+		}
+
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale upload state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute checksum of %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uploadChunked uploads task result in chunks, continuing interrupted upload
+// of the same file if its state was saved. errChunkedUnsupported is returned
+// if the web interface does not support it.
+func (c *Client) uploadChunked(ctx context.Context, ttId uint, ttr *TaskResultPayload, onProgress UploadProgressFunc) error {
+	info, err := os.Stat(ttr.FilePath)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return errChunkedUnsupported
+	}
+
+	state := c.loadUploadState(ttId, ttr.FilePath, info)
+	if state != nil {
+		session, err := c.getUploadSession(ctx, state.UploadID)
+		if err != nil {
+			var serverErr *ServerError
+			if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusNotFound {
+				if abandoned(ctx, err) {
+					c.removeUploadState(state)
+				}
+				return err
+			}
+			log.Printf("Upload of %s expired on web interface, starting over", ttr.FilePath)
+			c.removeUploadState(state)
+			state = nil
+		} else if err := checkOffset(state, session.Offset); err != nil {
+			log.Printf("Starting upload of %s over, %s", ttr.FilePath, err.Error())
+			c.removeUploadState(state)
+			state = nil
+		} else {
+			log.Printf("Resuming upload of %s from byte %d of %d", ttr.FilePath, session.Offset, state.Size)
+			state.Offset = session.Offset
+		}
+	}
+
+	if state == nil {
+		checksum, err := fileChecksum(ttr.FilePath)
+		if err != nil {
+			return err
+		}
+
+		session, err := c.startUploadSession(ctx, ttId, &UploadSessionPayload{
+			Name:        ttr.Name,
+			Type:        ttr.Type,
+			Description: ttr.Description,
+			Size:        info.Size(),
+		})
+		if err != nil {
+			return err
+		}
+
+		chunkSize := c.chunkSize
+		if session.ChunkSize > 0 {
+			chunkSize = session.ChunkSize
+		}
+
+		state = &uploadState{
+			UploadID:  session.ID,
+			TaskID:    ttId,
+			FilePath:  ttr.FilePath,
+			Size:      info.Size(),
+			ModTime:   info.ModTime(),
+			SHA256:    checksum,
+			ChunkSize: chunkSize,
+		}
+		err = checkOffset(state, session.Offset)
+		if err != nil {
+			return err
+		}
+		state.Offset = session.Offset
+		err = c.saveUploadState(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.uploadChunks(ctx, state, onProgress)
+	if err != nil {
+		if abandoned(ctx, err) {
+			c.removeUploadState(state)
+		}
+		return err
+	}
+
+	body, err := c.finalizeUpload(ctx, state.UploadID, &FinalizeUploadPayload{
+		Size:   state.Size,
+		SHA256: state.SHA256,
+	})
+	if err == nil || abandoned(ctx, err) {
+		c.removeUploadState(state)
+	}
+	if err != nil {
+		return err
+	}
+
+	return verifyTaskResult(body, fileDigest{SHA256: state.SHA256, Size: state.Size})
+}
+
+func (c *Client) uploadChunks(ctx context.Context, state *uploadState, onProgress UploadProgressFunc) error {
+	file, err := os.Open(state.FilePath)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	buf := make([]byte, state.ChunkSize)
+	stalled := 0
+	for state.Offset < state.Size {
+		n, err := file.ReadAt(buf, state.Offset)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read %s: %w", state.FilePath, err)
+		}
+		if n == 0 {
+			return fmt.Errorf("file %s was truncated during upload", state.FilePath)
+		}
+
+		offset, err := c.uploadChunk(ctx, state, buf[:n])
+		if err != nil {
+			return err
+		}
+		if offset <= state.Offset {
+			stalled++
+			if stalled >= maxStalledResyncs {
+				return fmt.Errorf("upload of %s does not progress, web interface keeps reporting offset %d", state.FilePath, offset)
+			}
+		} else {
+			stalled = 0
+		}
+
+		state.Offset = offset
+		err = c.saveUploadState(state)
+		if err != nil {
+			return err
+		}
+		onProgress(state.Offset, state.Size)
+	}
+
+	return nil
+}
+
+// uploadChunk sends chunk starting at offset of the state and returns offset
+// the upload continues from.
+func (c *Client) uploadChunk(ctx context.Context, state *uploadState, chunk []byte) (int64, error) {
+	index := state.Offset / state.ChunkSize
+	path := fmt.Sprintf("/training-task-results/uploads/%s/chunks/%d", state.UploadID, index)
+
+	resp, _, err := c.doWithRetries(ctx, c.uploadTimeout, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "PUT", c.baseURL+path, bytes.NewReader(chunk))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("Content-Type", "application/octet-stream")
+		req.Header.Add("Upload-Offset", strconv.FormatInt(state.Offset, 10))
+
+		return req, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return state.Offset + int64(len(chunk)), nil
+	case http.StatusConflict:
+		// server has different offset, continue from the one it reports
+		session, err := c.getUploadSession(ctx, state.UploadID)
+		if err != nil {
+			return 0, err
+		}
+		err = checkOffset(state, session.Offset)
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("Upload of %s is at byte %d on web interface, continuing from there", state.FilePath, session.Offset)
+		return session.Offset, nil
+	}
+
+	return 0, newServerError(resp, "failed to upload chunk of task result")
+}
+
+// checkOffset returns error if offset reported by web interface is not
+// a start of a chunk of the file, chunks are numbered by their offset.
+func checkOffset(state *uploadState, offset int64) error {
+	if offset < 0 || offset > state.Size || offset%state.ChunkSize != 0 && offset != state.Size {
+		return fmt.Errorf("web interface reported invalid offset %d of upload of %s, chunk size %d, size %d", offset, state.FilePath, state.ChunkSize, state.Size)
+	}
+
+	return nil
+}
+
+// abandoned reports whether upload failed with err cannot be continued, so
+// its state can be removed.
+func abandoned(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !IsTransient(err) && !errors.Is(err, ErrUnauthorized)
+}
+
+func (c *Client) startUploadSession(ctx context.Context, ttId uint, payload *UploadSessionPayload) (*UploadSessionResponse, error) {
+	path := fmt.Sprintf("/training-tasks/%d/training-task-results/uploads", ttId)
+
+	resp, body, err := c.sendRequest(ctx, "POST", path, payload, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, errChunkedUnsupported
+	case http.StatusUnprocessableEntity:
+		return nil, newServerError(resp, "invalid task result")
+	case http.StatusCreated:
+	default:
+		return nil, newServerError(resp, "failed to start upload of task result")
+	}
+
+	var session UploadSessionResponse
+	err = json.Unmarshal(body, &session)
+	if err != nil || session.ID == "" {
+		return nil, fmt.Errorf("invalid upload session response: %s", string(body))
+	}
+
+	return &session, nil
+}
+
+func (c *Client) getUploadSession(ctx context.Context, uploadId string) (*UploadSessionResponse, error) {
+	path := fmt.Sprintf("/training-task-results/uploads/%s", uploadId)
+
+	resp, body, err := c.sendRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newServerError(resp, "failed to get upload of task result")
+	}
+
+	var session UploadSessionResponse
+	err = json.Unmarshal(body, &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &session, nil
+}
+
+// finalizeUpload finishes chunked upload and returns body of the response
+// with created task result.
+func (c *Client) finalizeUpload(ctx context.Context, uploadId string, payload *FinalizeUploadPayload) ([]byte, error) {
+	path := fmt.Sprintf("/training-task-results/uploads/%s/finalize", uploadId)
+
+	resp, body, err := c.sendRequest(ctx, "POST", path, payload, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, newServerError(resp, "task result rejected by web interface").Error())
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newServerError(resp, "failed to finalize upload of task result")
+	}
+
+	return body, nil
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeUploads is web interface supporting chunked uploads. conflict makes
+// it answer every chunk with 409, offset is offset reported for the upload.
+type fakeUploads struct {
+	chunkSize int64
+	offset    atomic.Int64
+	conflict  bool
+	chunks    atomic.Int32
+	received  []byte
+}
+
+func (f *fakeUploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/training-task-results/uploads"):
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(UploadSessionResponse{ID: "u1", ChunkSize: f.chunkSize})
+	case r.Method == "GET" && r.URL.Path == "/training-task-results/uploads/u1":
+		json.NewEncoder(w).Encode(UploadSessionResponse{ID: "u1", Offset: f.offset.Load(), ChunkSize: f.chunkSize})
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/training-task-results/uploads/u1/chunks/"):
+		f.chunks.Add(1)
+		if f.conflict {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.received = append(f.received, data...)
+		f.offset.Add(int64(len(data)))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && r.URL.Path == "/training-task-results/uploads/u1/finalize":
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newUploadTest(t *testing.T, handler http.Handler) (*Client, string, string) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	stateDir := filepath.Join(dir, "uploads")
+	filePath := filepath.Join(dir, "model.onnx")
+	err := os.WriteFile(filePath, []byte("0123456789"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(server.URL, 1, "secret", WithChunkedUploads(stateDir, 4), WithRetries(0, time.Millisecond, time.Millisecond))
+	return c, filePath, stateDir
+}
+
+func uploadStates(t *testing.T, stateDir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(stateDir, "upload-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return paths
+}
+
+func TestChunkedUpload(t *testing.T) {
+	fake := &fakeUploads{chunkSize: 4}
+	c, filePath, stateDir := newUploadTest(t, fake)
+
+	err := c.UploadTaskResult(context.Background(), 1, &TaskResultPayload{Name: "model", Type: Onnx, FilePath: filePath, Progress: func(int64, int64) {}})
+	if err != nil {
+		t.Fatalf("UploadTaskResult: %v", err)
+	}
+	if string(fake.received) != "0123456789" || fake.chunks.Load() != 3 {
+		t.Errorf("received %q in %d chunks, want whole file in 3 chunks", fake.received, fake.chunks.Load())
+	}
+	if states := uploadStates(t, stateDir); len(states) != 0 {
+		t.Errorf("upload states %v left after finished upload", states)
+	}
+}
+
+func TestChunkedUploadStalledConflicts(t *testing.T) {
+	fake := &fakeUploads{chunkSize: 4, conflict: true}
+	c, filePath, stateDir := newUploadTest(t, fake)
+
+	err := c.UploadTaskResult(context.Background(), 1, &TaskResultPayload{Name: "model", Type: Onnx, FilePath: filePath, Progress: func(int64, int64) {}})
+	if err == nil || !strings.Contains(err.Error(), "does not progress") {
+		t.Fatalf("UploadTaskResult = %v, want error of upload without progress", err)
+	}
+	if fake.chunks.Load() != maxStalledResyncs {
+		t.Errorf("sent %d chunks, want %d", fake.chunks.Load(), maxStalledResyncs)
+	}
+	if states := uploadStates(t, stateDir); len(states) != 0 {
+		t.Errorf("upload states %v left after abandoned upload", states)
+	}
+}
+
+func TestChunkedUploadUnalignedOffset(t *testing.T) {
+	fake := &fakeUploads{chunkSize: 4, conflict: true}
+	fake.offset.Store(3)
+	c, filePath, stateDir := newUploadTest(t, fake)
+
+	err := c.UploadTaskResult(context.Background(), 1, &TaskResultPayload{Name: "model", Type: Onnx, FilePath: filePath, Progress: func(int64, int64) {}})
+	if err == nil || !strings.Contains(err.Error(), "invalid offset 3") {
+		t.Fatalf("UploadTaskResult = %v, want error of invalid offset", err)
+	}
+	if fake.chunks.Load() != 1 {
+		t.Errorf("sent %d chunks, want 1", fake.chunks.Load())
+	}
+	if states := uploadStates(t, stateDir); len(states) != 0 {
+		t.Errorf("upload states %v left after abandoned upload", states)
+	}
+}
+
+func TestRemoveStaleUploads(t *testing.T) {
+	c, filePath, stateDir := newUploadTest(t, http.NotFoundHandler())
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := &uploadState{UploadID: "u1", TaskID: 1, FilePath: filePath, Size: info.Size(), ModTime: info.ModTime(), ChunkSize: 4}
+	removed := &uploadState{UploadID: "u2", TaskID: 1, FilePath: filePath + ".removed", Size: 1, ChunkSize: 4}
+	for _, state := range []*uploadState{current, removed} {
+		err = c.saveUploadState(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = c.RemoveStaleUploads()
+	if err != nil {
+		t.Fatalf("RemoveStaleUploads: %v", err)
+	}
+	states := uploadStates(t, stateDir)
+	if len(states) != 1 || states[0] != c.uploadStatePath(current.TaskID, current.FilePath) {
+		t.Errorf("upload states %v, want only state of existing file", states)
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRequestTimeout  = 60 * time.Second
+	defaultMaxRetries      = 3
+	defaultRetryInitial    = 500 * time.Millisecond
+	defaultRetryMax        = 10 * time.Second
+	defaultResponseTimeout = 2 * time.Minute
+)
+
+// Client communicates with AliceTraINT web interface on behalf of a single
+// training machine.
+type Client struct {
+	baseURL    string
+	machineID  uint
+	secretKey  string
+	httpClient *http.Client
+
+	requestTimeout time.Duration
+	uploadTimeout  time.Duration
+	maxRetries     int
+	retryInitial   time.Duration
+	retryMax       time.Duration
+
+	signRequests bool
+
+	chunkSize        int64
+	uploadStateDir   string
+	chunkUnsupported atomic.Bool
+}
+
+type Option func(c *Client)
+
+// WithRequestTimeout sets timeout of API requests, uploads of task results
+// are bounded by upload timeout instead. Zero means no timeout.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithUploadTimeout sets timeout of a single upload of task result. Zero,
+// the default, means no timeout.
+func WithUploadTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.uploadTimeout = timeout
+	}
+}
+
+// WithRetries sets how many times request failed because of network error or
+// 5xx/429 response is retried and bounds of exponential backoff between
+// retries.
+func WithRetries(maxRetries int, initial, max time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryInitial = initial
+		c.retryMax = max
+	}
+}
+
+// WithChunkedUploads makes task results upload in chunks of given size when
+// web interface supports it. Progress of the uploads is saved in stateDir,
+// so interrupted upload continues where it stopped.
+func WithChunkedUploads(stateDir string, chunkSize int64) Option {
+	return func(c *Client) {
+		c.uploadStateDir = stateDir
+		c.chunkSize = chunkSize
+	}
+}
+
+// WithRequestSigning makes the client sign requests with HMAC-SHA256 of
+// the machine secret instead of sending the secret itself. Web interface
+// must support signed requests.
+func WithRequestSigning() Option {
+	return func(c *Client) {
+		c.signRequests = true
+	}
+}
+
+// WithTransport replaces transport used to send requests, e.g. to direct
+// them to a local fake server.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+func New(baseURL string, machineID uint, secretKey string, opts ...Option) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = defaultResponseTimeout
+
+	c := &Client{
+		baseURL:        baseURL,
+		machineID:      machineID,
+		secretKey:      secretKey,
+		httpClient:     &http.Client{Transport: transport},
+		requestTimeout: defaultRequestTimeout,
+		maxRetries:     defaultMaxRetries,
+		retryInitial:   defaultRetryInitial,
+		retryMax:       defaultRetryMax,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) MachineID() uint {
+	return c.machineID
+}
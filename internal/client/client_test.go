@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRetryTest starts web interface answering request n (counted from 0)
+// with handler and returns client of it retrying quickly.
+func newRetryTest(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, n int32), opts ...Option) (*Client, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, requests.Add(1)-1)
+	}))
+	t.Cleanup(server.Close)
+
+	opts = append([]Option{WithRetries(3, time.Millisecond, time.Millisecond)}, opts...)
+	return New(server.URL, 1, "secret", opts...), &requests
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	c, requests := newRetryTest(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	tt, err := c.GetQueuedTask(context.Background())
+	if err != nil || tt != nil {
+		t.Fatalf("GetQueuedTask = %v, %v, want no task", tt, err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("sent %d requests, want 3", requests.Load())
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	c, requests := newRetryTest(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := c.GetQueuedTask(context.Background())
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GetQueuedTask error = %v, want server error 500", err)
+	}
+	if !IsTransient(err) {
+		t.Errorf("error %v is not transient", err)
+	}
+	if requests.Load() != 4 {
+		t.Errorf("sent %d requests, want 4", requests.Load())
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnprocessableEntity} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			c, requests := newRetryTest(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+				w.WriteHeader(status)
+			})
+
+			_, err := c.GetQueuedTask(context.Background())
+			if err == nil {
+				t.Fatal("GetQueuedTask succeeded")
+			}
+			if status == http.StatusUnauthorized && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("GetQueuedTask error = %v, want %v", err, ErrUnauthorized)
+			}
+			if requests.Load() != 1 {
+				t.Errorf("sent %d requests, want 1", requests.Load())
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	c, requests := newRetryTest(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 0 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	start := time.Now()
+	_, err := c.GetQueuedTask(context.Background())
+	if err != nil {
+		t.Fatalf("GetQueuedTask: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least 1s of Retry-After", elapsed)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("sent %d requests, want 2", requests.Load())
+	}
+}
+
+func TestRetryOnTimeout(t *testing.T) {
+	c, requests := newRetryTest(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		if n == 0 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}, WithRequestTimeout(50*time.Millisecond))
+
+	_, err := c.GetQueuedTask(context.Background())
+	if err != nil {
+		t.Fatalf("GetQueuedTask: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("sent %d requests, want 2", requests.Load())
+	}
+}
+
+func TestCancelDuringBackoff(t *testing.T) {
+	c, requests := newRetryTest(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, WithRetries(3, 10*time.Second, 10*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetQueuedTask(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetQueuedTask error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, backoff was not interrupted", elapsed)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("sent %d requests, want 1", requests.Load())
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestOptions(t *testing.T) {
+	c := New("http://example.com", 1, "secret")
+	if c.requestTimeout != defaultRequestTimeout || c.uploadTimeout != 0 || c.maxRetries != defaultMaxRetries ||
+		c.retryInitial != defaultRetryInitial || c.retryMax != defaultRetryMax || c.signRequests || c.chunkSize != 0 {
+		t.Errorf("unexpected defaults of client %+v", c)
+	}
+
+	var sent *http.Request
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Header: http.Header{}}, nil
+	})
+	c = New("http://example.com", 1, "secret",
+		WithRequestTimeout(time.Second),
+		WithUploadTimeout(time.Minute),
+		WithRetries(5, time.Millisecond, time.Second),
+		WithChunkedUploads("uploads", 1024),
+		WithRequestSigning(),
+		WithTransport(transport),
+	)
+	if c.requestTimeout != time.Second || c.uploadTimeout != time.Minute || c.maxRetries != 5 ||
+		c.retryInitial != time.Millisecond || c.retryMax != time.Second || c.uploadStateDir != "uploads" || c.chunkSize != 1024 {
+		t.Errorf("options not applied to client %+v", c)
+	}
+
+	_, err := c.GetQueuedTask(context.Background())
+	if err != nil {
+		t.Fatalf("GetQueuedTask: %v", err)
+	}
+	if sent == nil {
+		t.Fatal("request was not sent through the transport")
+	}
+	if sent.Header.Get(SignatureHeader) == "" || sent.Header.Get(SecretIdHeader) != "" {
+		t.Errorf("request is not signed, headers %v", sent.Header)
+	}
+}
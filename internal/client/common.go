@@ -2,126 +2,200 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"time"
 
-	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/backoff"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/logging"
 )
 
-func sendRequest(cfg *config.Config, method, path string, body interface{}, headers map[string]string) (*http.Response, []byte, error) {
-	url := fmt.Sprintf("%s%s", cfg.AlicetrainBaseUrl, path)
-
-	var requestBody io.Reader
+func (c *Client) sendRequest(ctx context.Context, method, path string, body interface{}, headers map[string]string) (*http.Response, []byte, error) {
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
+		var err error
+		data, err = json.Marshal(body)
 		if err != nil {
 			log.Printf("Error marshaling request body: %v", err)
 			return nil, nil, fmt.Errorf("failed to marshal request body: %v", err)
 		}
-		requestBody = bytes.NewBuffer(data)
 	}
 
-	req, err := http.NewRequest(method, url, requestBody)
-	if err != nil {
-		log.Printf("Error creating request: %v", err)
-		return nil, nil, fmt.Errorf("failed to create request: %v", err)
-	}
+	return c.doWithRetries(ctx, c.requestTimeout, func(ctx context.Context) (*http.Request, error) {
+		var requestBody io.Reader
+		if data != nil {
+			requestBody = bytes.NewReader(data)
+		}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Secret-Id", cfg.MachineSecretKey)
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, requestBody)
+		if err != nil {
+			return nil, err
+		}
 
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
+		req.Header.Add("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Add(key, value)
+		}
 
-	log.Printf("Sending %s request to %s with headers: %v", method, url, req.Header)
+		return req, nil
+	})
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// sendMultipartRequest streams form to the server with Content-Length set,
+// if size of the file is known. Signed request carries hash of the body
+// computed in advance, only forms with regular file can be signed. Progress
+// of sending the file is reported to onProgress. Digest of the file sent by
+// the last attempt is returned.
+func (c *Client) sendMultipartRequest(ctx context.Context, method, path string, form *multipartForm, headers map[string]string, onProgress UploadProgressFunc) (*http.Response, []byte, fileDigest, error) {
+	fileSize, err := form.fileSize()
 	if err != nil {
-		log.Printf("Error sending request: %v", err)
-		return nil, nil, fmt.Errorf("failed to execute request: %v", err)
+		return nil, nil, fileDigest{}, err
 	}
-	defer resp.Body.Close()
 
-	bodyResp, err := io.ReadAll(resp.Body)
+	contentLength, err := form.contentLength(fileSize)
 	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return nil, nil, fmt.Errorf("failed to read response body: %v", err)
+		log.Printf("Error creating multipart body: %v", err)
+		return nil, nil, fileDigest{}, err
 	}
 
-	log.Printf("Response Status: %s", resp.Status)
-	log.Printf("Response Body: %s", string(bodyResp))
+	var bodyHash string
+	if c.signRequests && fileSize >= 0 {
+		bodyHash, err = form.bodyHash()
+		if err != nil {
+			log.Printf("Error hashing multipart body: %v", err)
+			return nil, nil, fileDigest{}, err
+		}
+	}
 
-	return resp, bodyResp, nil
-}
+	var digest func() fileDigest
+	resp, body, err := c.doWithRetries(ctx, c.uploadTimeout, func(ctx context.Context) (*http.Request, error) {
+		var body io.ReadCloser
+		var err error
+		body, digest, err = form.body(fileSize, onProgress)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = contentLength
 
-func sendMultipartRequest(cfg *config.Config, method, path string, formData map[string]io.Reader, headers map[string]string) (*http.Response, []byte, error) {
-	url := fmt.Sprintf("%s%s", cfg.AlicetrainBaseUrl, path)
+		req.Header.Add("Content-Type", form.contentType())
+		if bodyHash != "" {
+			req.Header.Set(ContentSHA256Header, bodyHash)
+		}
+		for key, value := range headers {
+			req.Header.Add(key, value)
+		}
 
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
+		return req, nil
+	})
+	if err != nil {
+		return nil, nil, fileDigest{}, err
+	}
 
-	for fieldName, fileReader := range formData {
-		var fw io.Writer
-		var err error
+	return resp, body, digest(), nil
+}
 
-		if file, ok := fileReader.(*os.File); ok {
-			fw, err = writer.CreateFormFile(fieldName, file.Name())
-		} else {
-			fw, err = writer.CreateFormField(fieldName)
+// doWithRetries sends request created by newRequest, retrying it with
+// exponential backoff when it failed because of network error or 5xx/429
+// response. Every attempt is bounded by timeout, if it is not zero.
+func (c *Client) doWithRetries(ctx context.Context, timeout time.Duration, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, []byte, error) {
+	bo := backoff.New(c.retryInitial, c.retryMax)
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.do(ctx, timeout, newRequest)
+		if !c.shouldRetry(ctx, resp, err) || attempt >= c.maxRetries {
+			return resp, body, err
 		}
 
-		if err != nil {
-			log.Printf("Error creating form field: %v", err)
-			return nil, nil, fmt.Errorf("failed to create form field: %v", err)
+		wait := bo.Next()
+		if retryAfter := retryAfterDuration(resp); retryAfter > wait {
+			wait = retryAfter
 		}
 
-		_, err = io.Copy(fw, fileReader)
+		log.Printf("Request failed, retry %d of %d in %s", attempt+1, c.maxRetries, wait.Round(time.Millisecond))
+		err = backoff.Sleep(ctx, wait)
 		if err != nil {
-			log.Printf("Error copying data to form field: %v", err)
-			return nil, nil, fmt.Errorf("failed to copy data to form field: %v", err)
+			return nil, nil, err
 		}
 	}
+}
 
-	writer.Close()
+func (c *Client) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
 
-	req, err := http.NewRequest(method, url, &requestBody)
 	if err != nil {
-		log.Printf("Error creating request: %v", err)
-		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+		var urlErr *url.Error
+		return errors.As(err, &urlErr)
 	}
 
-	req.Header.Add("Content-Type", writer.FormDataContentType())
-	req.Header.Add("Secret-Id", cfg.MachineSecretKey)
+	return resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+}
 
-	for key, value := range headers {
-		req.Header.Add(key, value)
+func retryAfterDuration(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
 	}
 
-	log.Printf("Sending %s request to %s with headers: %v", method, url, req.Header)
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	return time.Duration(seconds) * time.Second
+}
+
+func (c *Client) do(ctx context.Context, timeout time.Duration, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, []byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := newRequest(ctx)
+	if err != nil {
+		log.Printf("Error creating request: %v", err)
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	err = c.authorize(req)
+	if err != nil {
+		log.Printf("Error signing request: %v", err)
+		return nil, nil, err
+	}
+
+	logging.Debugf("Sending %s request to %s with headers: %v", req.Method, req.URL, redactHeaders(req.Header))
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		log.Printf("Error sending request: %v", err)
-		return nil, nil, fmt.Errorf("failed to execute request: %v", err)
+		return nil, nil, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil, ErrUnauthorized
+	}
+
 	bodyResp, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Printf("Error reading response body: %v", err)
-		return nil, nil, fmt.Errorf("failed to read response body: %v", err)
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	log.Printf("Response Status: %s", resp.Status)
-	log.Printf("Response Body: %s", string(bodyResp))
+	logging.Debugf("Response Status: %s", resp.Status)
+	logging.Debugf("Response Body: %s", string(bodyResp))
 
 	return resp, bodyResp, nil
 }
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// ErrUnauthorized is returned when web interface rejects credentials of the
+// machine, retrying the request cannot help.
+var ErrUnauthorized = errors.New("machine credentials rejected by web interface")
+
+// ErrChecksumMismatch is returned when checksum of task result echoed by web
+// interface differs from checksum of the uploaded file.
+var ErrChecksumMismatch = errors.New("checksum of task result on web interface does not match the file")
+
+// ServerError is unexpected HTTP status of web interface response.
+type ServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+func newServerError(resp *http.Response, message string) error {
+	return &ServerError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+	}
+}
+
+// IsTransient reports whether request failed because of network error or
+// outage of web interface, so it may succeed when retried.
+func IsTransient(err error) bool {
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode >= http.StatusInternalServerError || serverErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
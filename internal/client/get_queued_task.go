@@ -1,27 +1,31 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-
-	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"net/url"
+	"strconv"
 )
 
 type AODFile struct {
 	Path string
 }
 
+// TrainingTaskResponse is training task assigned to the machine.
+// Configuration is kept raw, it is parsed and validated by training package.
 type TrainingTaskResponse struct {
 	ID            uint
+	Status        TrainingTaskStatus
 	AODFiles      []AODFile
-	Configuration interface{}
+	Configuration json.RawMessage
 }
 
-func GetQueuedTask(cfg *config.Config) (*TrainingTaskResponse, error) {
-	path := fmt.Sprintf("/training-machines/%d/training-task", cfg.MachineID)
+func (c *Client) GetQueuedTask(ctx context.Context) (*TrainingTaskResponse, error) {
+	path := fmt.Sprintf("/training-machines/%d/training-task", c.machineID)
 
-	resp, body, err := sendRequest(cfg, "GET", path, nil, nil)
+	resp, body, err := c.sendRequest(ctx, "GET", path, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +35,7 @@ func GetQueuedTask(cfg *config.Config) (*TrainingTaskResponse, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("internal server error")
+		return nil, newServerError(resp, "internal server error")
 	}
 
 	var ttr TrainingTaskResponse
@@ -42,3 +46,30 @@ func GetQueuedTask(cfg *config.Config) (*TrainingTaskResponse, error) {
 
 	return &ttr, nil
 }
+
+// GetAssignedTasks returns training tasks assigned to the machine, which have
+// one of given statuses.
+func (c *Client) GetAssignedTasks(ctx context.Context, statuses ...TrainingTaskStatus) ([]TrainingTaskResponse, error) {
+	query := url.Values{}
+	for _, status := range statuses {
+		query.Add("status", strconv.FormatUint(uint64(status), 10))
+	}
+	path := fmt.Sprintf("/training-machines/%d/training-tasks?%s", c.machineID, query.Encode())
+
+	resp, body, err := c.sendRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newServerError(resp, "internal server error")
+	}
+
+	var tasks []TrainingTaskResponse
+	err = json.Unmarshal(body, &tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type TaskStatusResponse struct {
+	Status TrainingTaskStatus
+}
+
+func (c *Client) GetTaskStatus(ctx context.Context, ttId uint) (TrainingTaskStatus, error) {
+	path := fmt.Sprintf("/training-tasks/%d/status", ttId)
+
+	resp, body, err := c.sendRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, newServerError(resp, "training task not found")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newServerError(resp, "internal server error")
+	}
+
+	var tsr TaskStatusResponse
+	err = json.Unmarshal(body, &tsr)
+	if err != nil {
+		return 0, err
+	}
+
+	return tsr.Status, nil
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIMajorVersion is major version of web interface API the module speaks.
+// Web interface with different major version is incompatible.
+const APIMajorVersion = 1
+
+// legacyAPIVersion is assumed for web interfaces which predate the handshake.
+const legacyAPIVersion = "1.0"
+
+var ErrIncompatibleAPI = errors.New("incompatible web interface API version")
+
+// PythonPackage is package installed in Python virtual environment.
+type PythonPackage struct {
+	Name    string
+	Version string
+}
+
+// MachineInventory describes hardware and software of the training machine.
+// Values which could not be determined are left empty.
+type MachineInventory struct {
+	CPUCount         int
+	MemoryBytes      uint64
+	DataDirFreeBytes uint64
+	OS               string
+	GoVersion        string
+	ModuleVersion    string
+	ModuleCommit     string
+	O2PhysicsVersion string
+	PdiCommit        string
+	PythonPackages   []PythonPackage
+	StageTypes       []string
+	PdiCommands      []string
+	PipelineStages   []string
+}
+
+// HandshakeResponse is answer of web interface to the machine inventory.
+type HandshakeResponse struct {
+	APIVersion string
+}
+
+// Handshake sends inventory of the machine to web interface and returns
+// version of its API. Web interface without handshake support is assumed
+// to have API version 1.0.
+func (c *Client) Handshake(ctx context.Context, inventory *MachineInventory) (*HandshakeResponse, error) {
+	path := fmt.Sprintf("/training-machines/%d/handshake", c.machineID)
+
+	resp, body, err := c.sendRequest(ctx, "POST", path, inventory, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return &HandshakeResponse{APIVersion: legacyAPIVersion}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newServerError(resp, "handshake failed")
+	}
+
+	var handshake HandshakeResponse
+	err = json.Unmarshal(body, &handshake)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &handshake, nil
+}
+
+// CheckAPIVersion returns ErrIncompatibleAPI if major version of web
+// interface API differs from APIMajorVersion.
+func CheckAPIVersion(version string) error {
+	majorStr, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return fmt.Errorf("%w: malformed version %q", ErrIncompatibleAPI, version)
+	}
+
+	if major != APIMajorVersion {
+		return fmt.Errorf("%w: web interface has version %s, module supports %d.x", ErrIncompatibleAPI, version, APIMajorVersion)
+	}
+
+	return nil
+}
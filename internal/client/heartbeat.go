@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// HeartbeatPayload reports that the machine is alive together with its
+// current activity and resource usage. Busy is set while the machine runs a
+// training task, TaskID and Stage are set only if the task was issued by the
+// web interface receiving the heartbeat.
+type HeartbeatPayload struct {
+	Busy              bool
+	TaskID            uint   `json:",omitempty"`
+	Stage             string `json:",omitempty"`
+	LoadAverage       [3]float64
+	MemoryTotalBytes  uint64
+	MemoryUsedBytes   uint64
+	DataDirTotalBytes uint64
+	DataDirUsedBytes  uint64
+}
+
+func (c *Client) SendHeartbeat(ctx context.Context, heartbeat *HeartbeatPayload) error {
+	path := fmt.Sprintf("/training-machines/%d/heartbeat", c.machineID)
+
+	resp, _, err := c.sendRequest(ctx, "POST", path, heartbeat, nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return newServerError(resp, "heartbeat rejected")
+	}
+
+	return nil
+}
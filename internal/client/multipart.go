@@ -0,0 +1,254 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadProgressFunc is called while file is uploaded with number of bytes
+// sent so far and total size of the file (-1 if unknown).
+type UploadProgressFunc func(sent, total int64)
+
+// uploadProgressLogInterval limits how often default upload progress is
+// logged.
+const uploadProgressLogInterval = 10 * time.Second
+
+type formField struct {
+	Name  string
+	Value string
+}
+
+// multipartForm is multipart body with plain fields followed by a single
+// file. The file is streamed from disk, so it never has to fit in memory.
+type multipartForm struct {
+	Fields    []formField
+	FileField string
+	FilePath  string
+	boundary  string
+}
+
+func newMultipartForm(fields []formField, fileField, filePath string) *multipartForm {
+	return &multipartForm{
+		Fields:    fields,
+		FileField: fileField,
+		FilePath:  filePath,
+		boundary:  multipart.NewWriter(io.Discard).Boundary(),
+	}
+}
+
+func (f *multipartForm) contentType() string {
+	return "multipart/form-data; boundary=" + f.boundary
+}
+
+// fileSize returns size of the file, -1 if it is not a regular file.
+func (f *multipartForm) fileSize() (int64, error) {
+	info, err := os.Stat(f.FilePath)
+	if err != nil {
+		return 0, fmt.Errorf("error opening file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return -1, nil
+	}
+
+	return info.Size(), nil
+}
+
+// fileDigest is SHA-256 checksum and size of the file computed while it is
+// streamed, sent as form fields after the file.
+type fileDigest struct {
+	SHA256 string
+	Size   int64
+}
+
+func (d fileDigest) fields() []formField {
+	return []formField{
+		{Name: "sha256", Value: d.SHA256},
+		{Name: "size", Value: strconv.FormatInt(d.Size, 10)},
+	}
+}
+
+// contentLength computes length of the whole body, -1 if it cannot be known
+// in advance.
+func (f *multipartForm) contentLength(fileSize int64) (int64, error) {
+	if fileSize < 0 {
+		return -1, nil
+	}
+
+	placeholder := fileDigest{
+		SHA256: strings.Repeat("0", hex.EncodedLen(sha256.Size)),
+		Size:   fileSize,
+	}
+
+	counter := &countingWriter{}
+	err := f.write(counter, nil, func() fileDigest { return placeholder })
+	if err != nil {
+		return 0, err
+	}
+
+	return counter.n + fileSize, nil
+}
+
+// write writes the body with file content read from file, nil file is
+// written as empty. Fields returned by digest are written after the file.
+func (f *multipartForm) write(w io.Writer, file io.Reader, digest func() fileDigest) error {
+	writer := multipart.NewWriter(w)
+	err := writer.SetBoundary(f.boundary)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range f.Fields {
+		err = writer.WriteField(field.Name, field.Value)
+		if err != nil {
+			return fmt.Errorf("failed to write form field: %w", err)
+		}
+	}
+
+	fw, err := writer.CreateFormFile(f.FileField, f.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create form field: %w", err)
+	}
+	if file != nil {
+		_, err = io.Copy(fw, file)
+		if err != nil {
+			return fmt.Errorf("failed to copy data to form field: %w", err)
+		}
+	}
+
+	for _, field := range digest().fields() {
+		err = writer.WriteField(field.Name, field.Value)
+		if err != nil {
+			return fmt.Errorf("failed to write form field: %w", err)
+		}
+	}
+
+	return writer.Close()
+}
+
+// bodyHash returns hex encoded SHA-256 of the whole body. The body is
+// written once without being sent, so streamed body can be signed. It must
+// not change until it is sent, boundary of the form is fixed, so only
+// modification of the file can change it.
+func (f *multipartForm) bodyHash() (string, error) {
+	file, err := os.Open(f.FilePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	fileHash := sha256.New()
+	reader := &progressReader{
+		reader:     io.TeeReader(file, fileHash),
+		onProgress: func(sent, total int64) {},
+	}
+	bodyHash := sha256.New()
+	err = f.write(bodyHash, reader, func() fileDigest {
+		return fileDigest{
+			SHA256: hex.EncodeToString(fileHash.Sum(nil)),
+			Size:   reader.sent,
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bodyHash.Sum(nil)), nil
+}
+
+// body starts streaming the body through a pipe, file is read as the request
+// is sent. Returned function stops streaming, if the server did not read the
+// whole body, and returns digest of the file sent.
+func (f *multipartForm) body(fileSize int64, onProgress UploadProgressFunc) (io.ReadCloser, func() fileDigest, error) {
+	file, err := os.Open(f.FilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	hash := sha256.New()
+	reader := &progressReader{
+		reader:     io.TeeReader(file, hash),
+		total:      fileSize,
+		onProgress: onProgress,
+	}
+	var digest fileDigest
+	digestFunc := func() fileDigest {
+		digest = fileDigest{
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+			Size:   reader.sent,
+		}
+		return digest
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer file.Close()
+		pw.CloseWithError(f.write(pw, reader, digestFunc))
+	}()
+
+	return pr, func() fileDigest {
+		pr.Close()
+		<-done
+		return digest
+	}, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+type progressReader struct {
+	reader     io.Reader
+	sent       int64
+	total      int64
+	onProgress UploadProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.sent += int64(n)
+	if n > 0 || err == io.EOF {
+		r.onProgress(r.sent, r.total)
+	}
+
+	return n, err
+}
+
+// logUploadProgress returns UploadProgressFunc logging progress of upload of
+// named file at most every uploadProgressLogInterval and when it is finished.
+func logUploadProgress(name string) UploadProgressFunc {
+	var mu sync.Mutex
+	var lastLog time.Time
+
+	return func(sent, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		finished := sent == total
+		if !finished && time.Since(lastLog) < uploadProgressLogInterval {
+			return
+		}
+		lastLog = time.Now()
+
+		if total > 0 {
+			log.Printf("Uploading %s: %d/%d bytes (%.1f%%)", name, sent, total, 100*float64(sent)/float64(total))
+		} else {
+			log.Printf("Uploading %s: %d bytes", name, sent)
+		}
+	}
+}
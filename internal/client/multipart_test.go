@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultipartContentLength(t *testing.T) {
+	fieldSets := map[string][]formField{
+		"no fields": nil,
+		"task result": {
+			{Name: "file-type", Value: "1"},
+			{Name: "name", Value: "model.onnx"},
+			{Name: "description", Value: ""},
+		},
+		"long and unicode values": {
+			{Name: "name", Value: "wykres pędu ✓"},
+			{Name: "description", Value: strings.Repeat("line\r\n", 500)},
+		},
+	}
+	fileSizes := []int{0, 1, 4095, 4096, 100_000}
+
+	for fieldsName, fields := range fieldSets {
+		for _, fileSize := range fileSizes {
+			t.Run(fmt.Sprintf("%s, %d bytes", fieldsName, fileSize), func(t *testing.T) {
+				content := bytes.Repeat([]byte{0xA5}, fileSize)
+				filePath := filepath.Join(t.TempDir(), "result.bin")
+				err := os.WriteFile(filePath, content, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				form := newMultipartForm(fields, "file", filePath)
+				size, err := form.fileSize()
+				if err != nil {
+					t.Fatal(err)
+				}
+				contentLength, err := form.contentLength(size)
+				if err != nil {
+					t.Fatalf("contentLength: %v", err)
+				}
+
+				body, done, err := form.body(size, func(int64, int64) {})
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				digest := done()
+
+				if int64(len(data)) != contentLength {
+					t.Errorf("contentLength = %d, written %d bytes", contentLength, len(data))
+				}
+				sum := sha256.Sum256(content)
+				if digest.SHA256 != hex.EncodeToString(sum[:]) || digest.Size != int64(fileSize) {
+					t.Errorf("digest = %+v, want checksum of %d bytes", digest, fileSize)
+				}
+				bodyHash, err := form.bodyHash()
+				if err != nil {
+					t.Fatalf("bodyHash: %v", err)
+				}
+				if sum := sha256.Sum256(data); bodyHash != hex.EncodeToString(sum[:]) {
+					t.Errorf("bodyHash = %s does not match written body", bodyHash)
+				}
+				checkMultipartBody(t, form, data, fields, content, digest)
+			})
+		}
+	}
+}
+
+// checkMultipartBody parses body and checks it carries fields, the file and
+// its digest in this order.
+func checkMultipartBody(t *testing.T, form *multipartForm, data []byte, fields []formField, content []byte, digest fileDigest) {
+	t.Helper()
+	_, params, err := mime.ParseMediaType(form.contentType())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []formField
+	want = append(want, fields...)
+	want = append(want, formField{Name: "file", Value: string(content)})
+	want = append(want, digest.fields()...)
+
+	reader := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			if i != len(want) {
+				t.Errorf("body has %d parts, want %d", i, len(want))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("failed to parse body: %v", err)
+		}
+		if i >= len(want) {
+			t.Fatalf("unexpected part %s", part.FormName())
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.FormName() != want[i].Name || string(value) != want[i].Value {
+			t.Errorf("part %d is %s of %d bytes, want %s of %d bytes", i, part.FormName(), len(value), want[i].Name, len(want[i].Value))
+		}
+	}
+}
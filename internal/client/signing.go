@@ -0,0 +1,144 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of signed requests. Signature is HMAC-SHA256 keyed by the machine
+// secret over method, path with query, timestamp and SHA-256 of the body,
+// each on its own line. Hash of streamed body, which cannot be read again,
+// has to be set in ContentSHA256Header before the request is signed.
+const (
+	MachineIdHeader     = "Machine-Id"
+	TimestampHeader     = "Signature-Timestamp"
+	ContentSHA256Header = "Content-Sha256"
+	SignatureHeader     = "Signature"
+	SecretIdHeader      = "Secret-Id"
+)
+
+// DefaultSignatureWindow is maximal difference between timestamp of signed
+// request and time of its verification.
+const DefaultSignatureWindow = 5 * time.Minute
+
+var ErrInvalidSignature = errors.New("invalid request signature")
+
+const redacted = "[REDACTED]"
+
+// authorize adds credentials of the machine to req, either the raw secret or
+// signature of the request.
+func (c *Client) authorize(req *http.Request) error {
+	if !c.signRequests {
+		req.Header.Set(SecretIdHeader, c.secretKey)
+		return nil
+	}
+
+	bodyHash, err := requestBodyHash(req)
+	if err != nil {
+		return fmt.Errorf("failed to hash request body: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(MachineIdHeader, strconv.FormatUint(uint64(c.machineID), 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(ContentSHA256Header, bodyHash)
+	req.Header.Set(SignatureHeader, sign(c.secretKey, req.Method, req.URL.RequestURI(), timestamp, bodyHash))
+
+	return nil
+}
+
+// requestBodyHash returns hex encoded SHA-256 of the body. Streamed body
+// which cannot be read again has to have its hash precomputed.
+func requestBodyHash(req *http.Request) (string, error) {
+	hash := sha256.New()
+	if req.Body == nil || req.Body == http.NoBody {
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+	if req.GetBody == nil {
+		bodyHash := req.Header.Get(ContentSHA256Header)
+		if bodyHash == "" {
+			return "", errors.New("streamed body without precomputed hash cannot be signed")
+		}
+		return bodyHash, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	_, err = io.Copy(hash, body)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func sign(secretKey, method, requestURI, timestamp, bodyHash string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, bodyHash}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks signature of request received by web interface.
+// Requests with timestamp further than window from now are rejected, so
+// captured requests cannot be replayed later. To verify its hash, the body is
+// read and replaced by its copy.
+func VerifySignature(req *http.Request, secretKey string, window time.Duration, now time.Time) error {
+	timestamp := req.Header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or malformed timestamp", ErrInvalidSignature)
+	}
+
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew > window || skew < -window {
+		return fmt.Errorf("%w: timestamp outside of %s window", ErrInvalidSignature, window)
+	}
+
+	bodyHash := req.Header.Get(ContentSHA256Header)
+	expected := sign(secretKey, req.Method, req.URL.RequestURI(), timestamp, bodyHash)
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get(SignatureHeader))) {
+		return ErrInvalidSignature
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close()
+	}
+	req.Body = io.NopCloser(strings.NewReader(string(body)))
+
+	sum := sha256.Sum256(body)
+	if !hmac.Equal([]byte(hex.EncodeToString(sum[:])), []byte(bodyHash)) {
+		return fmt.Errorf("%w: body does not match its hash", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// redactHeaders returns copy of headers safe for logging.
+func redactHeaders(header http.Header) http.Header {
+	redactedHeader := header.Clone()
+	for _, key := range []string{SecretIdHeader, SignatureHeader, "Authorization", "Proxy-Authorization"} {
+		if redactedHeader.Get(key) != "" {
+			redactedHeader.Set(key, redacted)
+		}
+	}
+
+	return redactedHeader
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, secretKey, target, body string) *http.Request {
+	t.Helper()
+	c := New("http://example.com", 7, secretKey, WithRequestSigning())
+	req, err := http.NewRequest("POST", target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.authorize(req)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	const target = "http://example.com/training-tasks/1/status?attempt=1"
+	const body = `{"Status":3}`
+
+	tests := []struct {
+		name   string
+		tamper func(req *http.Request)
+		now    time.Duration
+		secret string
+		valid  bool
+	}{
+		{name: "valid", valid: true},
+		{name: "skew within window", now: 4 * time.Minute, valid: true},
+		{name: "timestamp too old", now: DefaultSignatureWindow + time.Minute},
+		{name: "timestamp in future", now: -DefaultSignatureWindow - time.Minute},
+		{name: "wrong secret", secret: "other"},
+		{name: "tampered body", tamper: func(req *http.Request) {
+			req.Body = io.NopCloser(strings.NewReader(`{"Status":4}`))
+		}},
+		{name: "tampered path", tamper: func(req *http.Request) { req.URL.Path = "/training-tasks/2/status" }},
+		{name: "tampered query", tamper: func(req *http.Request) { req.URL.RawQuery = "attempt=2" }},
+		{name: "tampered method", tamper: func(req *http.Request) { req.Method = "PUT" }},
+		{name: "tampered body hash", tamper: func(req *http.Request) {
+			req.Header.Set(ContentSHA256Header, strings.Repeat("0", 64))
+		}},
+		{name: "missing timestamp", tamper: func(req *http.Request) { req.Header.Del(TimestampHeader) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := signedRequest(t, "secret", target, body)
+			if req.Header.Get(SecretIdHeader) != "" {
+				t.Fatal("signed request carries the secret")
+			}
+			if test.tamper != nil {
+				test.tamper(req)
+			}
+			secret := "secret"
+			if test.secret != "" {
+				secret = test.secret
+			}
+
+			err := VerifySignature(req, secret, DefaultSignatureWindow, time.Now().Add(test.now))
+			if test.valid && err != nil {
+				t.Errorf("VerifySignature = %v, want valid", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifySignature = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureKeepsBody(t *testing.T) {
+	req := signedRequest(t, "secret", "http://example.com/training-tasks/1/status", "body")
+	err := VerifySignature(req, "secret", DefaultSignatureWindow, time.Now())
+	if err != nil {
+		t.Fatalf("VerifySignature: %v", err)
+	}
+
+	data := make([]byte, 8)
+	n, _ := req.Body.Read(data)
+	if string(data[:n]) != "body" {
+		t.Errorf("body after verification = %q, want %q", data[:n], "body")
+	}
+}
+
+func TestSignedMultipartUpload(t *testing.T) {
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyErr = VerifySignature(r, "secret", DefaultSignatureWindow, time.Now())
+		if verifyErr != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "model.onnx")
+	err := os.WriteFile(filePath, []byte(strings.Repeat("model", 1000)), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(server.URL, 1, "secret", WithRequestSigning(), WithRetries(0, time.Millisecond, time.Millisecond))
+	err = c.UploadTaskResult(context.Background(), 1, &TaskResultPayload{Name: "model", Type: Onnx, FilePath: filePath, Progress: func(int64, int64) {}})
+	if err != nil {
+		t.Fatalf("UploadTaskResult: %v, verification: %v", err, verifyErr)
+	}
+}
+
+func TestStreamedBodyWithoutHash(t *testing.T) {
+	c := New("http://example.com", 7, "secret", WithRequestSigning())
+	req, err := http.NewRequest("POST", "http://example.com/training-tasks/1/training-task-results", io.NopCloser(strings.NewReader("stream")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.authorize(req)
+	if err == nil {
+		t.Error("authorize of streamed body without hash succeeded")
+	}
+}
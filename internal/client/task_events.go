@@ -0,0 +1,177 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrEventsUnsupported is returned when web interface does not provide
+// stream of task events, tasks have to be polled instead.
+var ErrEventsUnsupported = errors.New("task events not supported by web interface")
+
+// TaskEventQueued is sent by web interface when a training task was queued
+// for the machine.
+const TaskEventQueued = "task-queued"
+
+// eventsIdleTimeout closes stream which did not receive anything (not even
+// keep-alive comment) for this long, so dead connections are detected.
+const eventsIdleTimeout = 2 * time.Minute
+
+// TaskEvent is a single Server-Sent Event of task events stream. ID is the
+// last event ID set by the stream when the event was received.
+type TaskEvent struct {
+	Type string
+	Data string
+	ID   string
+}
+
+// TaskEventStream is open Server-Sent Events stream of task events.
+type TaskEventStream struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+	cancel  context.CancelFunc
+	idle    *time.Timer
+	once    sync.Once
+
+	lastEventID string
+	retry       time.Duration
+}
+
+// OpenTaskEvents opens stream of task events of the machine. Non-empty
+// lastEventID is sent in Last-Event-ID header, so web interface can replay
+// events missed while the stream was disconnected. It returns
+// ErrEventsUnsupported if web interface does not provide the stream.
+func (c *Client) OpenTaskEvents(ctx context.Context, lastEventID string) (*TaskEventStream, error) {
+	path := fmt.Sprintf("/training-machines/%d/training-tasks/events", c.machineID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("Accept", "text/event-stream")
+	req.Header.Add("Cache-Control", "no-cache")
+	if lastEventID != "" {
+		req.Header.Add("Last-Event-ID", lastEventID)
+	}
+	err = c.authorize(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	log.Printf("Opening task events stream %s", req.URL)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		err = ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusMethodNotAllowed, resp.StatusCode == http.StatusNotImplemented:
+		err = ErrEventsUnsupported
+	case resp.StatusCode != http.StatusOK:
+		err = newServerError(resp, "failed to open task events stream")
+	case !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		err = ErrEventsUnsupported
+	}
+	if err != nil {
+		resp.Body.Close()
+		cancel()
+		return nil, err
+	}
+
+	return &TaskEventStream{
+		resp:        resp,
+		scanner:     bufio.NewScanner(resp.Body),
+		cancel:      cancel,
+		idle:        time.AfterFunc(eventsIdleTimeout, cancel),
+		lastEventID: lastEventID,
+	}, nil
+}
+
+// LastEventID returns the last event ID set by the stream, it should be
+// passed to OpenTaskEvents when the stream is reopened.
+func (s *TaskEventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Retry returns reconnection delay requested by the stream, zero if it did
+// not request any.
+func (s *TaskEventStream) Retry() time.Duration {
+	return s.retry
+}
+
+// Next blocks until the next event is received. Keep-alive comments are
+// skipped, id and retry fields are recorded in the stream. Error is
+// returned when the stream was closed.
+func (s *TaskEventStream) Next() (TaskEvent, error) {
+	var event TaskEvent
+	var data []string
+	for s.scanner.Scan() {
+		s.idle.Reset(eventsIdleTimeout)
+
+		line := s.scanner.Text()
+		if line == "" {
+			if event.Type == "" && len(data) == 0 {
+				continue
+			}
+			if event.Type == "" {
+				event.Type = "message"
+			}
+			event.Data = strings.Join(data, "\n")
+			event.ID = s.lastEventID
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Type = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventID = value
+			}
+		case "retry":
+			ms, err := strconv.ParseUint(value, 10, 32)
+			if err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	err := s.scanner.Err()
+	if err == nil {
+		err = errors.New("task events stream closed by web interface")
+	}
+
+	return TaskEvent{}, err
+}
+
+func (s *TaskEventStream) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.idle.Stop()
+		s.cancel()
+		err = s.resp.Body.Close()
+	})
+
+	return err
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newEventsTest(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return New(server.URL, 1, "secret")
+}
+
+func serveEvents(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, body)
+	}
+}
+
+func TestTaskEventStream(t *testing.T) {
+	c := newEventsTest(t, serveEvents(": keep-alive\n\n"+
+		"event: task-queued\ndata: {}\nid: 1\n\n"+
+		": comment between fields\n"+
+		"data: first\n: comment\ndata: second\n\n"+
+		"data:without space\n\n"+
+		"retry: 1500\nid: 2\n\n"+
+		"\n\n"+
+		"id: 3\x00\nretry: soon\nunknown: field\nevent: task-queued\n\n"+
+		"data: unterminated\n"))
+
+	stream, err := c.OpenTaskEvents(context.Background(), "")
+	if err != nil {
+		t.Fatalf("OpenTaskEvents: %v", err)
+	}
+	defer stream.Close()
+
+	want := []TaskEvent{
+		{Type: TaskEventQueued, Data: "{}", ID: "1"},
+		{Type: "message", Data: "first\nsecond", ID: "1"},
+		{Type: "message", Data: "without space", ID: "1"},
+		{Type: TaskEventQueued, ID: "2"},
+	}
+	for _, wantEvent := range want {
+		event, err := stream.Next()
+		if err != nil {
+			t.Fatalf("Next: %v, want %+v", err, wantEvent)
+		}
+		if event != wantEvent {
+			t.Errorf("Next = %+v, want %+v", event, wantEvent)
+		}
+	}
+
+	event, err := stream.Next()
+	if err == nil {
+		t.Errorf("Next = %+v, want error of closed stream", event)
+	}
+	if stream.LastEventID() != "2" {
+		t.Errorf("LastEventID = %q, want %q", stream.LastEventID(), "2")
+	}
+	if stream.Retry() != 1500*time.Millisecond {
+		t.Errorf("Retry = %s, want 1.5s", stream.Retry())
+	}
+}
+
+func TestTaskEventsReconnect(t *testing.T) {
+	lastEventIDs := make(chan string, 2)
+	c := newEventsTest(t, func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs <- r.Header.Get("Last-Event-ID")
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "id: 5\nevent: task-queued\ndata: {}\n\n")
+	})
+
+	stream, err := c.OpenTaskEvents(context.Background(), "")
+	if err != nil {
+		t.Fatalf("OpenTaskEvents: %v", err)
+	}
+	for {
+		_, err = stream.Next()
+		if err != nil {
+			break
+		}
+	}
+	stream.Close()
+
+	stream, err = c.OpenTaskEvents(context.Background(), stream.LastEventID())
+	if err != nil {
+		t.Fatalf("OpenTaskEvents: %v", err)
+	}
+	stream.Close()
+
+	if first, second := <-lastEventIDs, <-lastEventIDs; first != "" || second != "5" {
+		t.Errorf("Last-Event-ID headers %q and %q, want none and %q", first, second, "5")
+	}
+}
+
+func TestTaskEventsUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+	}{
+		{"not found", http.NotFound, ErrEventsUnsupported},
+		{"not implemented", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotImplemented) }, ErrEventsUnsupported},
+		{"not event stream", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) }, ErrEventsUnsupported},
+		{"unauthorized", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) }, ErrUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newEventsTest(t, test.handler)
+			_, err := c.OpenTaskEvents(context.Background(), "")
+			if !errors.Is(err, test.want) {
+				t.Errorf("OpenTaskEvents error = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
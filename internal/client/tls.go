@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TLSOptions configures TLS connection to web interface. Certificates of CA
+// bundle are trusted in addition to system ones, client certificate is
+// presented to servers requiring mutual TLS. Empty paths are ignored.
+type TLSOptions struct {
+	CABundlePath   string
+	ClientCertPath string
+	ClientKeyPath  string
+	MinVersion     string
+}
+
+// CertificateInfo describes certificate, whose expiry is reported on startup.
+type CertificateInfo struct {
+	Source   string
+	Subject  string
+	NotAfter time.Time
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func ParseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected one of 1.0, 1.1, 1.2, 1.3", version)
+	}
+
+	return v, nil
+}
+
+// LoadTLSConfig builds TLS configuration from opts. Loaded certificates are
+// returned too, so their expiry can be checked.
+func LoadTLSConfig(opts TLSOptions) (*tls.Config, []CertificateInfo, error) {
+	minVersion, err := ParseTLSVersion(opts.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{MinVersion: minVersion}
+	var certs []CertificateInfo
+
+	if opts.CABundlePath != "" {
+		data, err := os.ReadFile(opts.CABundlePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		caCerts, err := parseCertificates(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse CA bundle %s: %w", opts.CABundlePath, err)
+		}
+		if len(caCerts) == 0 {
+			return nil, nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CABundlePath)
+		}
+		for _, cert := range caCerts {
+			pool.AddCert(cert)
+			certs = append(certs, newCertificateInfo("CA bundle", cert))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCertPath != "" || opts.ClientKeyPath != "" {
+		if opts.ClientCertPath == "" || opts.ClientKeyPath == "" {
+			return nil, nil, fmt.Errorf("both client certificate and key must be set")
+		}
+
+		pair, err := tls.LoadX509KeyPair(opts.ClientCertPath, opts.ClientKeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		if pair.Leaf == nil {
+			pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0])
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse client certificate: %w", err)
+			}
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+		certs = append(certs, newCertificateInfo("client certificate", pair.Leaf))
+	}
+
+	return tlsConfig, certs, nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func newCertificateInfo(source string, cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Source:   source,
+		Subject:  cert.Subject.String(),
+		NotAfter: cert.NotAfter,
+	}
+}
+
+// WithTLSConfig sets TLS configuration of connections to web interface.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *Client) {
+		if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+			transport.TLSClientConfig = tlsConfig
+		}
+	}
+}
+
+// WithProxy sends all requests through proxy at proxyURL instead of proxy
+// from HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(c *Client) {
+		if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+}
+
+// ServerCertificates connects to web interface and returns certificates it
+// presented, nil if it is not served over TLS.
+func (c *Client) ServerCertificates(ctx context.Context) ([]CertificateInfo, error) {
+	if c.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", c.baseURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil {
+		return nil, nil
+	}
+
+	var certs []CertificateInfo
+	for _, cert := range resp.TLS.PeerCertificates {
+		certs = append(certs, newCertificateInfo("web interface", cert))
+	}
+
+	return certs, nil
+}
@@ -1,10 +1,9 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-
-	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
 )
 
 type TrainingTaskStatus uint
@@ -15,30 +14,98 @@ const (
 	Training
 	Benchmarking
 	Completed
+	Cancelled
+	Downloading
+	Producing
+	Processing
+	Exploring
 )
 
-type UpdateTaskStatusPayload struct {
-	Status TrainingTaskStatus
+var trainingTaskStatusNames = map[TrainingTaskStatus]string{
+	Failed:       "Failed",
+	Queued:       "Queued",
+	Training:     "Training",
+	Benchmarking: "Benchmarking",
+	Completed:    "Completed",
+	Cancelled:    "Cancelled",
+	Downloading:  "Downloading",
+	Producing:    "Producing",
+	Processing:   "Processing",
+	Exploring:    "Exploring",
 }
 
-func UpdateTaskStatus(cfg *config.Config, ttId uint, status TrainingTaskStatus) error {
-	path := fmt.Sprintf("/training-tasks/%d/status", ttId)
+func (s TrainingTaskStatus) String() string {
+	name, ok := trainingTaskStatusNames[s]
+	if !ok {
+		return fmt.Sprintf("TrainingTaskStatus(%d)", uint(s))
+	}
 
-	statusPayload := UpdateTaskStatusPayload{
-		Status: status,
+	return name
+}
+
+func ParseTrainingTaskStatus(name string) (TrainingTaskStatus, error) {
+	for status, statusName := range trainingTaskStatusNames {
+		if statusName == name {
+			return status, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown training task status %q", name)
+}
+
+// ActiveStatuses are statuses of training tasks picked up by the training
+// machine and not finished yet.
+var ActiveStatuses = []TrainingTaskStatus{Downloading, Producing, Processing, Exploring, Training, Benchmarking}
+
+func (s TrainingTaskStatus) IsActive() bool {
+	for _, status := range ActiveStatuses {
+		if s == status {
+			return true
+		}
 	}
 
-	resp, _, err := sendRequest(cfg, "POST", path, statusPayload, nil)
+	return false
+}
+
+// FailureReport describes why training task failed: in which stage, class
+// of the error, its message and tail of the stage's logs.
+type FailureReport struct {
+	Stage   string `json:",omitempty"`
+	Class   string
+	Message string
+	LogTail string `json:",omitempty"`
+}
+
+// UpdateTaskStatusPayload is status of training task with optional progress
+// of its current stage in percents and human readable message. Failure is
+// sent only with Failed status.
+type UpdateTaskStatusPayload struct {
+	Status   TrainingTaskStatus
+	Progress *float64       `json:",omitempty"`
+	Message  string         `json:",omitempty"`
+	Failure  *FailureReport `json:",omitempty"`
+}
+
+func (c *Client) UpdateTaskStatus(ctx context.Context, ttId uint, status TrainingTaskStatus) error {
+	return c.UpdateTaskStatusWithPayload(ctx, ttId, &UpdateTaskStatusPayload{
+		Status: status,
+	})
+}
+
+func (c *Client) UpdateTaskStatusWithPayload(ctx context.Context, ttId uint, statusPayload *UpdateTaskStatusPayload) error {
+	path := fmt.Sprintf("/training-tasks/%d/status", ttId)
+
+	resp, _, err := c.sendRequest(ctx, "POST", path, statusPayload, nil)
 	if err != nil {
 		return err
 	}
 
 	if resp.StatusCode == http.StatusUnprocessableEntity {
-		return fmt.Errorf("invalid task status")
+		return newServerError(resp, "invalid task status")
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("internal server error")
+		return newServerError(resp, "internal server error")
 	}
 
 	return nil
@@ -1,13 +1,14 @@
 package client
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
-
-	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"strconv"
+	"strings"
 )
 
 type TaskResultType uint
@@ -31,46 +32,96 @@ func GetExtensionFromResultType(resType TaskResultType) string {
 	return ""
 }
 
+// TaskResultPayload describes file uploaded as training task result.
+// Progress, if set, is called while the file is uploaded, otherwise the
+// progress is logged.
 type TaskResultPayload struct {
 	Name        string
 	Type        TaskResultType
 	Description string
 	FilePath    string
+	Progress    UploadProgressFunc `json:"-"`
 }
 
-func intToReader(value int) io.Reader {
-	str := fmt.Sprintf("%d", value)
-
-	return bytes.NewBufferString(str)
+// TaskResultResponse is task result created by web interface. SHA256 and
+// Size echo checksum and size of the file received by the server.
+type TaskResultResponse struct {
+	ID     uint
+	SHA256 string
+	Size   int64
 }
 
-func UploadTaskResult(cfg *config.Config, ttId uint, ttr *TaskResultPayload) error {
-	path := fmt.Sprintf("/training-tasks/%d/training-task-results", ttId)
+// UploadTaskResult uploads the file as result of training task. If chunked
+// uploads are enabled and web interface supports them, the file is uploaded
+// in chunks, otherwise in a single multipart request. SHA-256 checksum and
+// size of the file are sent with it and verified against values echoed by web
+// interface, upload is retried when they do not match.
+func (c *Client) UploadTaskResult(ctx context.Context, ttId uint, ttr *TaskResultPayload) error {
+	onProgress := ttr.Progress
+	if onProgress == nil {
+		onProgress = logUploadProgress(ttr.Name)
+	}
 
-	file, err := os.Open(ttr.FilePath)
-	if err != nil {
-		return fmt.Errorf("error opening file: %s", err.Error())
+	for attempt := 0; ; attempt++ {
+		err := c.upload(ctx, ttId, ttr, onProgress)
+		if !errors.Is(err, ErrChecksumMismatch) || attempt >= c.maxRetries || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Checksum mismatch of %s on web interface, upload retry %d of %d", ttr.FilePath, attempt+1, c.maxRetries)
 	}
-	defer file.Close()
+}
 
-	formData := map[string]io.Reader{
-		"file":        file,
-		"file-type":   intToReader(int(ttr.Type)),
-		"name":        bytes.NewBufferString(ttr.Name),
-		"description": bytes.NewBufferString(ttr.Description),
+func (c *Client) upload(ctx context.Context, ttId uint, ttr *TaskResultPayload, onProgress UploadProgressFunc) error {
+	if c.chunkSize > 0 && !c.chunkUnsupported.Load() {
+		err := c.uploadChunked(ctx, ttId, ttr, onProgress)
+		if !errors.Is(err, errChunkedUnsupported) {
+			return err
+		}
+		log.Printf("Web interface does not support chunked uploads, uploading %s in single request", ttr.FilePath)
+		c.chunkUnsupported.Store(true)
 	}
 
-	resp, _, err := sendMultipartRequest(cfg, "POST", path, formData, nil)
+	return c.uploadMultipart(ctx, ttId, ttr, onProgress)
+}
+
+func (c *Client) uploadMultipart(ctx context.Context, ttId uint, ttr *TaskResultPayload, onProgress UploadProgressFunc) error {
+	path := fmt.Sprintf("/training-tasks/%d/training-task-results", ttId)
+
+	form := newMultipartForm([]formField{
+		{Name: "file-type", Value: strconv.Itoa(int(ttr.Type))},
+		{Name: "name", Value: ttr.Name},
+		{Name: "description", Value: ttr.Description},
+	}, "file", ttr.FilePath)
+
+	resp, body, digest, err := c.sendMultipartRequest(ctx, "POST", path, form, nil, onProgress)
 	if err != nil {
 		return err
 	}
 
 	if resp.StatusCode == http.StatusUnprocessableEntity {
-		return fmt.Errorf("invalid task result")
+		return newServerError(resp, "invalid task result")
 	}
 
 	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("internal server error")
+		return newServerError(resp, "internal server error")
+	}
+
+	return verifyTaskResult(body, digest)
+}
+
+// verifyTaskResult checks checksum and size echoed by web interface in body
+// of its response. Missing values are not verified, so servers which do not
+// echo them are still supported.
+func verifyTaskResult(body []byte, digest fileDigest) error {
+	var result TaskResultResponse
+	err := json.Unmarshal(body, &result)
+	if err != nil || result.SHA256 == "" {
+		log.Printf("Web interface did not echo checksum of task result, skipping verification")
+		return nil
+	}
+
+	if !strings.EqualFold(result.SHA256, digest.SHA256) || result.Size != 0 && result.Size != digest.Size {
+		return fmt.Errorf("%w: expected %s (%d bytes), got %s (%d bytes)", ErrChecksumMismatch, digest.SHA256, digest.Size, result.SHA256, result.Size)
 	}
 
 	return nil
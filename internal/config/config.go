@@ -1,73 +1,74 @@
 package config
 
 import (
-	"fmt"
+	"errors"
+	"flag"
 	"log"
 	"os"
-	"path/filepath"
-	"strconv"
-
-	"github.com/joho/godotenv"
 )
 
+// Config of the training module. Every field is described by `config` tag
+// with name of its environment variable and options: required (it has to be
+// set by some layer), path (relative paths are made absolute), secret
+// (redacted when printed), url (credentials redacted when printed) and
+// reload (new value is applied by Reload without restart).
+// Default value is given by `default` tag, allowed values by `enum` tag.
+// Key in config file and command line flag are derived from the variable
+// name, see Load. Values of list fields are JSON in environment variables and
+// command line flags.
 type Config struct {
-	MachineID          uint
-	MachineSecretKey   string
-	AlicetrainBaseUrl  string
-	DataDirPath        string
-	ScriptsDirPath     string
-	VenvDirPath        string
-	ResultsDirPath     string
-	PdiDirPath         string
-	PoolingWaitSeconds uint
-}
+	MachineID                uint            `config:"MACHINE_ID"`                // required by default profile
+	MachineSecretKey         string          `config:"MACHINE_SECRET_KEY,secret"` // read from secrets provider if not set
+	AlicetrainBaseUrl        string          `config:"ALICETRAINT_BASE_URL"`      // required by default profile
+	DataDirPath              string          `config:"ALICETRAINT_DATA_DIR_PATH,path" default:"./data"`
+	ScriptsDirPath           string          `config:"ALICETRAINT_SCRIPTS_DIR_PATH,path" default:"./scripts"`
+	VenvDirPath              string          `config:"ALICETRAINT_VENV_DIR_PATH,path" default:"./.venv"`
+	ResultsDirPath           string          `config:"ALICETRAINT_RESULTS_DIR_PATH,path" default:"./results"`
+	PdiDirPath               string          `config:"ALICETRAINT_PDI_SRC_DIR_PATH,path" default:"./pdi/src"`
+	StateDirPath             string          `config:"ALICETRAINT_STATE_DIR_PATH,path" default:"./state"`
+	SpoolDirPath             string          `config:"ALICETRAINT_SPOOL_DIR_PATH,path" default:"./spool"`
+	PoolingWaitSeconds       uint            `config:"ALICETRAINT_POOLING_WAIT_SECONDS,reload" default:"20"`
+	TaskSource               string          `config:"ALICETRAINT_TASK_SOURCE" default:"events" enum:"polling,events"`
+	PipelineFilePath         string          `config:"ALICETRAINT_PIPELINE_FILE_PATH,path"` // defaults to pipeline.json in scripts dir
+	ShutdownGraceSeconds     uint            `config:"ALICETRAINT_SHUTDOWN_GRACE_SECONDS,reload" default:"20"`
+	CancellationCheckSeconds uint            `config:"ALICETRAINT_CANCELLATION_CHECK_SECONDS,reload" default:"60"`
+	HeartbeatSeconds         uint            `config:"ALICETRAINT_HEARTBEAT_SECONDS" default:"60"`
+	MaxBackoffSeconds        uint            `config:"ALICETRAINT_MAX_BACKOFF_SECONDS" default:"300"`
+	RequestTimeoutSeconds    uint            `config:"ALICETRAINT_REQUEST_TIMEOUT_SECONDS" default:"60"`
+	UploadTimeoutSeconds     uint            `config:"ALICETRAINT_UPLOAD_TIMEOUT_SECONDS" default:"0"`
+	RequestRetries           uint            `config:"ALICETRAINT_REQUEST_RETRIES" default:"3"`
+	RequestSigning           bool            `config:"ALICETRAINT_REQUEST_SIGNING" default:"false"`
+	TLSCABundlePath          string          `config:"ALICETRAINT_TLS_CA_BUNDLE_PATH,path"`
+	TLSClientCertPath        string          `config:"ALICETRAINT_TLS_CLIENT_CERT_PATH,path"`
+	TLSClientKeyPath         string          `config:"ALICETRAINT_TLS_CLIENT_KEY_PATH,path"`
+	TLSMinVersion            string          `config:"ALICETRAINT_TLS_MIN_VERSION" default:"1.2" enum:"1.0,1.1,1.2,1.3"`
+	ProxyURL                 string          `config:"ALICETRAINT_PROXY_URL,url"`
+	UploadChunkSizeMB        uint            `config:"ALICETRAINT_UPLOAD_CHUNK_SIZE_MB" default:"16"`
+	LogLevel                 string          `config:"ALICETRAINT_LOG_LEVEL,reload" default:"info" enum:"debug,info"`
+	SecretsProvider          string          `config:"ALICETRAINT_SECRETS_PROVIDER" default:"env" enum:"env,file,keystore"`
+	SecretsDirPath           string          `config:"ALICETRAINT_SECRETS_DIR_PATH,path" default:"/run/secrets"`
+	KeystorePath             string          `config:"ALICETRAINT_KEYSTORE_PATH,path" default:"./keystore.json"`
+	KeystorePassphrase       string          `config:"ALICETRAINT_KEYSTORE_PASSPHRASE,secret"`
+	KeystorePassphrasePath   string          `config:"ALICETRAINT_KEYSTORE_PASSPHRASE_PATH,path"`
+	Servers                  []ServerProfile `config:"ALICETRAINT_SERVERS"` // JSON list in environment and flags
 
-func LoadConfig() *Config {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
+	// ConfigFilePath is path of config file used by Load, empty if there
+	// is none.
+	ConfigFilePath string
 
-	return &Config{
-		MachineID:          getEnvAsUint("MACHINE_ID"),
-		MachineSecretKey:   getEnv("MACHINE_SECRET_KEY"),
-		AlicetrainBaseUrl:  getEnv("ALICETRAINT_BASE_URL"),
-		DataDirPath:        getEnvPath("ALICETRAINT_DATA_DIR_PATH"),
-		ScriptsDirPath:     getEnvPath("ALICETRAINT_SCRIPTS_DIR_PATH"),
-		VenvDirPath:        getEnvPath("ALICETRAINT_VENV_DIR_PATH"),
-		ResultsDirPath:     getEnvPath("ALICETRAINT_RESULTS_DIR_PATH"),
-		PdiDirPath:         getEnvPath("ALICETRAINT_PDI_SRC_DIR_PATH"),
-		PoolingWaitSeconds: getEnvAsUint("ALICETRAINT_POOLING_WAIT_SECONDS"),
-	}
+	secrets SecretProvider
 }
 
-func getEnv(key string) string {
-	value, exists := os.LookupEnv(key)
-	if !exists {
-		log.Fatal(fmt.Errorf("ENV: %s not present", key))
-	}
-
-	return value
-}
-
-func getEnvPath(key string) string {
-	value := getEnv(key)
-
-	valueAbs, err := filepath.Abs(value)
-	if err != nil {
-		log.Fatal(fmt.Errorf("ENV: %s cannot calculate absolute path", key))
+// LoadConfig loads configuration from all layers with command line flags
+// of the process, it terminates the process if configuration is invalid.
+func LoadConfig() *Config {
+	cfg, err := Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-
-	return valueAbs
-}
-
-func getEnvAsUint(key string) uint {
-	valueStr := getEnv(key)
-
-	value, err := strconv.ParseUint(valueStr, 10, 32)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal(err.Error())
 	}
 
-	return uint(value)
+	return cfg
 }
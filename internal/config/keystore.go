@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	keystoreVersion    = 1
+	keystoreKDF        = "pbkdf2-sha256"
+	keystoreIterations = 600000
+	keystoreSaltSize   = 16
+	keystoreKeySize    = 32
+)
+
+var ErrWrongPassphrase = errors.New("wrong keystore passphrase or corrupted keystore")
+
+// keystoreFile is JSON representation of keystore. Secrets are encrypted
+// together as JSON object by AES-256-GCM with key derived from passphrase by
+// PBKDF2-HMAC-SHA256.
+type keystoreFile struct {
+	Version    int
+	KDF        string
+	Iterations int
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// Keystore is local file with secrets encrypted by passphrase.
+type Keystore struct {
+	path       string
+	passphrase string
+	secrets    map[string][]byte
+}
+
+// OpenKeystore decrypts keystore at path, keystore which does not exist yet
+// is empty.
+func OpenKeystore(path, passphrase string) (*Keystore, error) {
+	ks := &Keystore{
+		path:       path,
+		passphrase: passphrase,
+		secrets:    make(map[string][]byte),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	var file keystoreFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keystore %s: %w", path, err)
+	}
+	if file.Version != keystoreVersion || file.KDF != keystoreKDF {
+		return nil, fmt.Errorf("unsupported keystore %s: version %d, kdf %s", path, file.Version, file.KDF)
+	}
+
+	gcm, err := keystoreCipher(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	err = json.Unmarshal(plaintext, &ks.secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keystore secrets: %w", err)
+	}
+
+	return ks, nil
+}
+
+func (ks *Keystore) Get(name string) ([]byte, error) {
+	secret, ok := ks.secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s in keystore %s", ErrSecretNotFound, name, ks.path)
+	}
+
+	return secret, nil
+}
+
+func (ks *Keystore) Set(name string, secret []byte) {
+	ks.secrets[name] = secret
+}
+
+func (ks *Keystore) Delete(name string) {
+	delete(ks.secrets, name)
+}
+
+// Names returns sorted names of stored secrets.
+func (ks *Keystore) Names() []string {
+	names := make([]string, 0, len(ks.secrets))
+	for name := range ks.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Save encrypts keystore with new salt and nonce and atomically replaces
+// its file.
+func (ks *Keystore) Save() error {
+	plaintext, err := json.Marshal(ks.secrets)
+	if err != nil {
+		return err
+	}
+
+	file := keystoreFile{
+		Version:    keystoreVersion,
+		KDF:        keystoreKDF,
+		Iterations: keystoreIterations,
+		Salt:       make([]byte, keystoreSaltSize),
+	}
+	_, err = rand.Read(file.Salt)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := keystoreCipher(ks.passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	_, err = rand.Read(file.Nonce)
+	if err != nil {
+		return err
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), filepath.Base(ks.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), ks.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save keystore: %w", err)
+	}
+
+	return nil
+}
+
+func keystoreCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("invalid keystore iterations %d", iterations)
+	}
+
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, keystoreKeySize))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives key from password as defined in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	return pbkdf2.Key(password, salt, iterations, keyLen, sha256.New)
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPbkdf2SHA256(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		keyLen     int
+		want       string
+	}{
+		// RFC 7914, section 11
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		// RFC 6070 inputs with HMAC-SHA256
+		{"password", "salt", 1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, 32, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, test.keyLen))
+		if got != test.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d, %d) = %s, want %s", test.password, test.salt, test.iterations, test.keyLen, got, test.want)
+		}
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+
+	ks, err := OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("OpenKeystore of missing file: %v", err)
+	}
+	if len(ks.Names()) != 0 {
+		t.Fatalf("new keystore has secrets %v", ks.Names())
+	}
+	ks.Set("b", []byte("secret b"))
+	ks.Set("a", []byte("secret a"))
+	ks.Set("c", []byte("secret c"))
+	ks.Delete("c")
+	err = ks.Save()
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("keystore mode %v, want 0600", info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret a")) {
+		t.Error("keystore file contains plaintext secret")
+	}
+
+	ks, err = OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatalf("OpenKeystore: %v", err)
+	}
+	if names := ks.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("Names() = %v, want [a b]", names)
+	}
+	secret, err := ks.Get("a")
+	if err != nil || string(secret) != "secret a" {
+		t.Errorf("Get(a) = %q, %v", secret, err)
+	}
+	_, err = ks.Get("c")
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Get of deleted secret: %v, want ErrSecretNotFound", err)
+	}
+
+	_, err = OpenKeystore(path, "wrong")
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenKeystore with wrong passphrase: %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestKeystoreTampered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("a", []byte("secret a"))
+	err = ks.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file keystoreFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Ciphertext[0] ^= 1
+	data, err = json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenKeystore(path, "passphrase")
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenKeystore of tampered keystore: %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestKeystoreSecretsCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	ks, err := OpenKeystore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("a", []byte("secret a"))
+	err = ks.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &keystoreSecrets{path: path, passphrase: "passphrase"}
+	secret, err := p.Secret("a")
+	if err != nil || string(secret) != "secret a" {
+		t.Fatalf("Secret(a) = %q, %v", secret, err)
+	}
+	cached := p.ks
+	_, err = p.Secret("b")
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Secret(b) = %v, want ErrSecretNotFound", err)
+	}
+	if p.ks != cached {
+		t.Error("unmodified keystore was opened again")
+	}
+
+	ks.Set("b", []byte("secret b"))
+	err = ks.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// make sure modification time differs on filesystems with coarse timestamps
+	later := time.Now().Add(time.Second)
+	err = os.Chtimes(path, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err = p.Secret("b")
+	if err != nil || string(secret) != "secret b" {
+		t.Errorf("Secret(b) after modification = %q, %v", secret, err)
+	}
+}
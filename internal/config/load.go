@@ -0,0 +1,315 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	// ConfigFileEnv is environment variable with path of config file, it
+	// can be also given by -config flag.
+	ConfigFileEnv = "ALICETRAINT_CONFIG_FILE"
+
+	// DotenvPath is path of optional .env file with environment variables.
+	DotenvPath = ".env"
+
+	envPrefix      = "ALICETRAINT_"
+	configFileFlag = "config"
+)
+
+type field struct {
+	value      reflect.Value
+	env        string
+	defaultStr string
+	hasDefault bool
+	enum       []string
+	required   bool
+	path       bool
+	secret     bool
+	url        bool
+	reload     bool
+}
+
+// fields describes fields of cfg by their `config` tags.
+func fields(cfg *Config) []*field {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+
+	var result []*field
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("config")
+		if !ok {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		f := &field{value: v.Field(i), env: name}
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "required":
+				f.required = true
+			case "path":
+				f.path = true
+			case "secret":
+				f.secret = true
+			case "url":
+				f.url = true
+			case "reload":
+				f.reload = true
+			}
+		}
+		f.defaultStr, f.hasDefault = t.Field(i).Tag.Lookup("default")
+		if enum, ok := t.Field(i).Tag.Lookup("enum"); ok {
+			f.enum = strings.Split(enum, ",")
+		}
+		result = append(result, f)
+	}
+
+	return result
+}
+
+// key is name of the field in config file: variable name without
+// ALICETRAINT_ prefix in lower case, e.g. data_dir_path.
+func (f *field) key() string {
+	return strings.ToLower(strings.TrimPrefix(f.env, envPrefix))
+}
+
+// flagName is name of command line flag of the field, e.g. -data-dir-path.
+func (f *field) flagName() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+func (f *field) set(value string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(value)
+	case reflect.Uint:
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		f.value.SetUint(v)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		f.value.SetBool(v)
+	case reflect.Slice:
+		v := reflect.New(f.value.Type())
+		err := json.Unmarshal([]byte(value), v.Interface())
+		if err != nil {
+			return fmt.Errorf("invalid JSON list: %w", err)
+		}
+		f.value.Set(v.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+
+	return nil
+}
+
+// flagValue is value of command line flag, applied after all other layers.
+type flagValue struct {
+	isBool bool
+	value  string
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// Load loads configuration merged from layers, each overriding the previous
+// one: defaults, config file (given by -config flag or ALICETRAINT_CONFIG_FILE
+// variable), environment variables (with .env file, if it exists) and
+// command line flags. All invalid values are reported in returned error at
+// once. Variables from .env file are not exported to the environment, so
+// changes of the file are seen when configuration is loaded again.
+func Load(args []string) (*Config, error) {
+	return load(args, true)
+}
+
+// LoadWithoutProfiles loads configuration like Load, but server profiles are
+// not resolved, so machine secrets are not needed. It is used to manage the
+// keystore, which may be where machine secrets are stored.
+func LoadWithoutProfiles(args []string) (*Config, error) {
+	return load(args, false)
+}
+
+func load(args []string, profiles bool) (*Config, error) {
+	cfg := &Config{}
+	cfgFields := fields(cfg)
+
+	flagSet := flag.NewFlagSet("AliceTraINT_pidml_training_module", flag.ContinueOnError)
+	configPath := flagSet.String(configFileFlag, "", "path of JSON config file, overrides "+ConfigFileEnv)
+	flagFields := make(map[string]*field)
+	for _, f := range cfgFields {
+		flagFields[f.flagName()] = f
+		flagSet.Var(&flagValue{isBool: f.value.Kind() == reflect.Bool}, f.flagName(), "overrides "+f.env)
+	}
+	err := flagSet.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, f := range cfgFields {
+		if f.hasDefault {
+			err = f.set(f.defaultStr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("default of %s: %w", f.env, err))
+			}
+		}
+	}
+
+	dotenv, err := godotenv.Read(DotenvPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, fmt.Errorf("error loading .env file: %w", err))
+	}
+	lookupEnv := func(key string) (string, bool) {
+		if value, exists := os.LookupEnv(key); exists {
+			return value, true
+		}
+		value, exists := dotenv[key]
+		return value, exists
+	}
+
+	if *configPath == "" {
+		*configPath, _ = lookupEnv(ConfigFileEnv)
+	}
+	if *configPath != "" {
+		cfg.ConfigFilePath, err = filepath.Abs(*configPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config file: cannot calculate absolute path: %w", err))
+		}
+		errs = append(errs, loadFile(*configPath, cfgFields)...)
+	}
+
+	for _, f := range cfgFields {
+		if value, exists := lookupEnv(f.env); exists {
+			err = f.set(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: %w", f.env, err))
+			}
+		}
+	}
+
+	flagSet.Visit(func(fl *flag.Flag) {
+		f, ok := flagFields[fl.Name]
+		if !ok {
+			return
+		}
+
+		err := f.set(fl.Value.String())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flag -%s: %w", fl.Name, err))
+		}
+	})
+
+	if cfg.PipelineFilePath == "" {
+		cfg.PipelineFilePath = filepath.Join(cfg.ScriptsDirPath, "pipeline.json")
+	}
+
+	errs = append(errs, validate(cfgFields)...)
+	if len(errs) == 0 {
+		cfg.secrets = newSecretProvider(cfg, lookupEnv)
+	}
+	if len(errs) == 0 && profiles {
+		errs = append(errs, cfg.loadProfiles()...)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return cfg, nil
+}
+
+// loadFile sets fields from JSON config file with keys described by
+// field.key.
+func loadFile(path string, fields []*field) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("error reading config file: %w", err)}
+	}
+
+	var values map[string]json.RawMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	err = decoder.Decode(&values)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after JSON object")
+	}
+	if err != nil {
+		return []error{fmt.Errorf("config file %s: %w", path, err)}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var errs []error
+	for _, key := range keys {
+		raw := values[key]
+		i := slices.IndexFunc(fields, func(f *field) bool { return f.key() == key })
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("config file %s: unknown key %q", path, key))
+			continue
+		}
+
+		err = json.Unmarshal(raw, fields[i].value.Addr().Interface())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config file %s: key %q: invalid value %s", path, key, raw))
+		}
+	}
+
+	return errs
+}
+
+// validate checks required and enum fields and makes paths absolute.
+func validate(fields []*field) []error {
+	var errs []error
+	for _, f := range fields {
+		if f.required && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", f.env))
+			continue
+		}
+
+		if f.enum != nil && !slices.Contains(f.enum, f.value.String()) {
+			errs = append(errs, fmt.Errorf("%s must be one of %s, got %q", f.env, strings.Join(f.enum, ", "), f.value.String()))
+		}
+
+		if f.path && f.value.String() != "" {
+			path, err := filepath.Abs(f.value.String())
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: cannot calculate absolute path: %w", f.env, err))
+				continue
+			}
+			f.value.SetString(path)
+		}
+	}
+
+	return errs
+}
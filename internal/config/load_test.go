@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newLoadTest runs the test in empty working directory, so .env file is
+// created by the test only, with minimal environment of default profile.
+// Variables in unset are removed from environment for the test.
+func newLoadTest(t *testing.T, unset ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("MACHINE_ID", "1")
+	t.Setenv("MACHINE_SECRET_KEY", "secret")
+	t.Setenv("ALICETRAINT_BASE_URL", "http://localhost:8088")
+	for _, key := range append(unset, ConfigFileEnv, "ALICETRAINT_SERVERS") {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const env = "ALICETRAINT_POOLING_WAIT_SECONDS"
+	tests := []struct {
+		name string
+		// layers setting the value: file, dotenv, env and flag
+		layers []string
+		want   uint
+	}{
+		{"default", nil, 20},
+		{"file over default", []string{"file"}, 21},
+		{".env over file", []string{"file", "dotenv"}, 22},
+		{"environment over .env", []string{"file", "dotenv", "env"}, 23},
+		{"environment over file", []string{"file", "env"}, 23},
+		{"flag over all", []string{"file", "dotenv", "env", "flag"}, 24},
+		{"flag over default", []string{"flag"}, 24},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newLoadTest(t, env)
+			configPath := filepath.Join(dir, "config.json")
+			writeFile(t, configPath, `{"task_source": "polling"}`)
+
+			args := []string{"-config", configPath}
+			for _, layer := range test.layers {
+				switch layer {
+				case "file":
+					writeFile(t, configPath, `{"task_source": "polling", "pooling_wait_seconds": 21}`)
+				case "dotenv":
+					writeFile(t, filepath.Join(dir, DotenvPath), env+"=22\n")
+				case "env":
+					t.Setenv(env, "23")
+				case "flag":
+					args = append(args, "-pooling-wait-seconds", "24")
+				}
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.PoolingWaitSeconds != test.want {
+				t.Errorf("PoolingWaitSeconds = %d, want %d", cfg.PoolingWaitSeconds, test.want)
+			}
+			if cfg.TaskSource != "polling" || cfg.ConfigFilePath != configPath {
+				t.Errorf("TaskSource = %q from %q, want %q from config file %q", cfg.TaskSource, cfg.ConfigFilePath, "polling", configPath)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFilePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		dotenv string
+		env    string
+		flag   string
+		want   string
+	}{
+		{"none", "", "", "", ""},
+		{".env", "dotenv.json", "", "", "dotenv.json"},
+		{"environment over .env", "dotenv.json", "env.json", "", "env.json"},
+		{"flag over environment", "dotenv.json", "env.json", "flag.json", "flag.json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newLoadTest(t)
+			for _, name := range []string{"dotenv.json", "env.json", "flag.json"} {
+				writeFile(t, filepath.Join(dir, name), "{}")
+			}
+			if test.dotenv != "" {
+				writeFile(t, filepath.Join(dir, DotenvPath), ConfigFileEnv+"="+test.dotenv+"\n")
+			}
+			if test.env != "" {
+				t.Setenv(ConfigFileEnv, test.env)
+			}
+			var args []string
+			if test.flag != "" {
+				args = []string{"-config", test.flag}
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			want := test.want
+			if want != "" {
+				want = filepath.Join(dir, want)
+			}
+			if cfg.ConfigFilePath != want {
+				t.Errorf("ConfigFilePath = %q, want %q", cfg.ConfigFilePath, want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	dir := newLoadTest(t, "ALICETRAINT_TASK_SOURCE")
+	configPath := filepath.Join(dir, "config.json")
+	writeFile(t, configPath, `{"unknown_key": 1, "heartbeat_seconds": "often"}`)
+	t.Setenv("ALICETRAINT_TASK_SOURCE", "carrier-pigeon")
+
+	_, err := Load([]string{"-config", configPath, "-request-retries", "many"})
+	if err == nil {
+		t.Fatal("Load succeeded")
+	}
+	for _, want := range []string{
+		`unknown key "unknown_key"`,
+		`key "heartbeat_seconds": invalid value "often"`,
+		"ALICETRAINT_TASK_SOURCE must be one of polling, events",
+		"flag -request-retries: invalid unsigned integer",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load error = %q, want it to contain %q", err.Error(), want)
+		}
+	}
+}
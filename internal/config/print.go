@@ -0,0 +1,45 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+)
+
+const redacted = "[REDACTED]"
+
+// display returns value of the field with secrets and credentials in URLs
+// redacted.
+func (f *field) display() any {
+	if f.secret && !f.value.IsZero() {
+		return redacted
+	}
+	if profiles, ok := f.value.Interface().([]ServerProfile); ok {
+		redactedProfiles := make([]ServerProfile, 0, len(profiles))
+		for _, profile := range profiles {
+			redactedProfiles = append(redactedProfiles, profile.redacted())
+		}
+		return redactedProfiles
+	}
+	if f.url {
+		u, err := url.Parse(f.value.String())
+		if err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+
+	return f.value.Interface()
+}
+
+// Print writes effective configuration to w as JSON config file, with
+// secrets and credentials in URLs redacted.
+func (c *Config) Print(w io.Writer) error {
+	values := make(map[string]any)
+	for _, f := range fields(c) {
+		values[f.key()] = f.display()
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfileName is name of server profile given by MACHINE_ID,
+// MACHINE_SECRET_KEY and ALICETRAINT_BASE_URL.
+const DefaultProfileName = "default"
+
+// profileNamePattern restricts profile names, they are used as directory
+// names.
+var profileNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// ServerProfile is AliceTraINT web interface the machine is registered in.
+// Tasks are requested from profiles with higher priority first. Secret of
+// the profile is read from machine-secret-key-<name> secret if it is not set.
+type ServerProfile struct {
+	Name             string `json:"name"`
+	BaseUrl          string `json:"base_url"`
+	MachineID        uint   `json:"machine_id"`
+	MachineSecretKey string `json:"machine_secret_key,omitempty"`
+	Priority         int    `json:"priority"`
+}
+
+// Dir returns subdirectory of base for data kept separately for every
+// profile, like task states and spool. Default profile uses base itself.
+func (p ServerProfile) Dir(base string) string {
+	if p.Name == DefaultProfileName {
+		return base
+	}
+
+	return filepath.Join(base, "servers", p.Name)
+}
+
+func (p ServerProfile) redacted() ServerProfile {
+	if p.MachineSecretKey != "" {
+		p.MachineSecretKey = redacted
+	}
+
+	return p
+}
+
+func (p ServerProfile) String() string {
+	return fmt.Sprintf("%s (%s, machine %d, priority %d)", p.Name, p.BaseUrl, p.MachineID, p.Priority)
+}
+
+// hasDefaultProfile reports whether default profile is configured, it is
+// required when there are no other profiles.
+func (c *Config) hasDefaultProfile() bool {
+	return len(c.Servers) == 0 || c.MachineID != 0 || c.AlicetrainBaseUrl != "" || c.MachineSecretKey != ""
+}
+
+// Profiles returns server profiles ordered by priority, default profile
+// first among profiles of the same priority.
+func (c *Config) Profiles() []ServerProfile {
+	var profiles []ServerProfile
+	if c.hasDefaultProfile() {
+		profiles = append(profiles, ServerProfile{
+			Name:             DefaultProfileName,
+			BaseUrl:          c.AlicetrainBaseUrl,
+			MachineID:        c.MachineID,
+			MachineSecretKey: c.MachineSecretKey,
+		})
+	}
+	profiles = append(profiles, c.Servers...)
+	sort.SliceStable(profiles, func(i, j int) bool { return profiles[i].Priority > profiles[j].Priority })
+
+	return profiles
+}
+
+// loadProfiles validates server profiles and loads their secrets from
+// secrets provider.
+func (c *Config) loadProfiles() []error {
+	var errs []error
+	if c.hasDefaultProfile() {
+		if c.MachineID == 0 {
+			errs = append(errs, errors.New("MACHINE_ID is required"))
+		}
+		if c.AlicetrainBaseUrl == "" {
+			errs = append(errs, errors.New("ALICETRAINT_BASE_URL is required"))
+		}
+		err := c.loadMachineSecret()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	names := map[string]bool{DefaultProfileName: true}
+	for i := range c.Servers {
+		profile := &c.Servers[i]
+		if !profileNamePattern.MatchString(profile.Name) {
+			errs = append(errs, fmt.Errorf("server profile %d: invalid name %q, only letters, digits, - and _ are allowed", i, profile.Name))
+			continue
+		}
+		if names[profile.Name] {
+			errs = append(errs, fmt.Errorf("server profile %s: duplicated name", profile.Name))
+			continue
+		}
+		names[profile.Name] = true
+
+		if profile.BaseUrl == "" {
+			errs = append(errs, fmt.Errorf("server profile %s: base_url is required", profile.Name))
+		}
+		if profile.MachineID == 0 {
+			errs = append(errs, fmt.Errorf("server profile %s: machine_id is required", profile.Name))
+		}
+		if profile.MachineSecretKey != "" {
+			continue
+		}
+
+		secretName := SecretMachineKey + "-" + profile.Name
+		secret, err := c.Secrets().Secret(secretName)
+		if errors.Is(err, ErrSecretNotFound) {
+			errs = append(errs, fmt.Errorf("server profile %s: machine_secret_key is required, set it or store %s secret in %s secrets provider", profile.Name, secretName, c.SecretsProvider))
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server profile %s: failed to load machine secret: %w", profile.Name, err))
+			continue
+		}
+		profile.MachineSecretKey = strings.TrimSpace(string(secret))
+	}
+
+	return errs
+}
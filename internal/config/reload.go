@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is change of configuration field found by Reload, with values
+// redacted like in Print. Applied is false for fields which cannot be changed
+// without restart of the module.
+type Change struct {
+	Name    string
+	Old     string
+	New     string
+	Applied bool
+}
+
+func (ch Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", ch.Name, ch.Old, ch.New)
+}
+
+// Reload loads configuration again with args and applies new values of
+// reloadable fields to c. It returns all changed fields, c is not modified if
+// the new configuration is invalid.
+func (c *Config) Reload(args []string) ([]Change, error) {
+	newCfg, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
+
+	newFields := fields(newCfg)
+	var changes []Change
+	for i, f := range fields(c) {
+		newField := newFields[i]
+		if reflect.DeepEqual(f.value.Interface(), newField.value.Interface()) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Name:    f.env,
+			Old:     fmt.Sprint(f.display()),
+			New:     fmt.Sprint(newField.display()),
+			Applied: f.reload,
+		})
+		if f.reload {
+			f.value.Set(newField.value)
+		}
+	}
+
+	return changes, nil
+}
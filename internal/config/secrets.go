@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SecretsProviderEnv      = "env"
+	SecretsProviderFile     = "file"
+	SecretsProviderKeystore = "keystore"
+)
+
+// Names of secrets used by the module.
+const (
+	SecretMachineKey   = "machine-secret-key"
+	SecretGridUserCert = "grid-usercert"
+	SecretGridUserKey  = "grid-userkey"
+)
+
+// secretEnvPrefix prefixes names of environment variables read by env
+// provider, e.g. grid-usercert is read from ALICETRAINT_SECRET_GRID_USERCERT.
+const secretEnvPrefix = "ALICETRAINT_SECRET_"
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves secrets by name. It returns error wrapping
+// ErrSecretNotFound if the secret is not stored in the provider.
+type SecretProvider interface {
+	Secret(name string) ([]byte, error)
+}
+
+// envSecrets reads secrets from environment variables.
+type envSecrets struct {
+	lookupEnv func(key string) (string, bool)
+}
+
+func secretEnv(name string) string {
+	return secretEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func (p envSecrets) Secret(name string) ([]byte, error) {
+	value, exists := p.lookupEnv(secretEnv(name))
+	if !exists {
+		return nil, fmt.Errorf("%w: environment variable %s is not set", ErrSecretNotFound, secretEnv(name))
+	}
+
+	return []byte(value), nil
+}
+
+// fileSecrets reads every secret from file of the same name in directory,
+// like Docker and Kubernetes secrets mounted in /run/secrets.
+type fileSecrets struct {
+	dir string
+}
+
+func (p fileSecrets) Secret(name string) ([]byte, error) {
+	value, err := os.ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: no file %s in %s", ErrSecretNotFound, name, p.dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+
+	return value, nil
+}
+
+// keystoreSecrets reads secrets from encrypted keystore. Decrypted keystore
+// is cached and opened again only when its file is modified, so secrets added
+// to the keystore are seen without restart, but the expensive derivation of
+// key from passphrase is not repeated on every access.
+type keystoreSecrets struct {
+	path           string
+	passphrase     string
+	passphrasePath string
+
+	mu      sync.Mutex
+	ks      *Keystore
+	modTime time.Time
+}
+
+func (p *keystoreSecrets) Secret(name string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var modTime time.Time
+	info, err := os.Stat(p.path)
+	if err == nil {
+		modTime = info.ModTime()
+	}
+	if p.ks == nil || !modTime.Equal(p.modTime) {
+		ks, err := p.open()
+		if err != nil {
+			return nil, err
+		}
+		p.ks = ks
+		p.modTime = modTime
+	}
+
+	return p.ks.Get(name)
+}
+
+func (p *keystoreSecrets) open() (*Keystore, error) {
+	passphrase := p.passphrase
+	if passphrase == "" && p.passphrasePath != "" {
+		data, err := os.ReadFile(p.passphrasePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keystore passphrase: %w", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+	if passphrase == "" {
+		return nil, errors.New("keystore passphrase is not set")
+	}
+
+	return OpenKeystore(p.path, passphrase)
+}
+
+// OpenKeystore decrypts keystore of keystore secrets provider configured by
+// ALICETRAINT_KEYSTORE_PATH and passphrase, which does not have to be the
+// selected provider.
+func (c *Config) OpenKeystore() (*Keystore, error) {
+	p := &keystoreSecrets{
+		path:           c.KeystorePath,
+		passphrase:     c.KeystorePassphrase,
+		passphrasePath: c.KeystorePassphrasePath,
+	}
+
+	return p.open()
+}
+
+// restrictedSecrets allows access only to listed secrets.
+type restrictedSecrets struct {
+	provider SecretProvider
+	names    []string
+}
+
+func (p restrictedSecrets) Secret(name string) ([]byte, error) {
+	if !slices.Contains(p.names, name) {
+		return nil, fmt.Errorf("%w: secret %s is not available here", ErrSecretNotFound, name)
+	}
+
+	return p.provider.Secret(name)
+}
+
+// RestrictSecrets returns provider allowing access only to named secrets of
+// p, so commands get only the secrets they need.
+func RestrictSecrets(p SecretProvider, names ...string) SecretProvider {
+	return restrictedSecrets{provider: p, names: names}
+}
+
+func newSecretProvider(c *Config, lookupEnv func(key string) (string, bool)) SecretProvider {
+	switch c.SecretsProvider {
+	case SecretsProviderFile:
+		return fileSecrets{dir: c.SecretsDirPath}
+	case SecretsProviderKeystore:
+		return &keystoreSecrets{
+			path:           c.KeystorePath,
+			passphrase:     c.KeystorePassphrase,
+			passphrasePath: c.KeystorePassphrasePath,
+		}
+	}
+
+	return envSecrets{lookupEnv: lookupEnv}
+}
+
+// Secrets returns provider of secrets selected in configuration.
+func (c *Config) Secrets() SecretProvider {
+	if c.secrets == nil {
+		return newSecretProvider(c, os.LookupEnv)
+	}
+
+	return c.secrets
+}
+
+// loadMachineSecret sets machine secret from secrets provider, if it is not
+// given directly.
+func (c *Config) loadMachineSecret() error {
+	if c.MachineSecretKey != "" {
+		return nil
+	}
+
+	secret, err := c.Secrets().Secret(SecretMachineKey)
+	if errors.Is(err, ErrSecretNotFound) {
+		return fmt.Errorf("MACHINE_SECRET_KEY is required, set it or store %s secret in %s secrets provider", SecretMachineKey, c.SecretsProvider)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load machine secret: %w", err)
+	}
+	c.MachineSecretKey = strings.TrimSpace(string(secret))
+
+	return nil
+}
+
+// IsModuleEnv reports whether environment variable configures the module.
+// Such variables are not passed to commands run by the module, many of them
+// hold secrets: machine secrets (also inside ALICETRAINT_SERVERS), keystore
+// passphrase, credentials of proxy and ALICETRAINT_SECRET_* variables.
+func IsModuleEnv(key string) bool {
+	return key == "MACHINE_ID" ||
+		key == "MACHINE_SECRET_KEY" ||
+		strings.HasPrefix(key, envPrefix)
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Level of logged messages, messages below current level are not logged.
+type Level int32
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+)
+
+var levelNames = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+}
+
+var level atomic.Int32
+
+func ParseLevel(name string) (Level, error) {
+	l, ok := levelNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+
+	return l, nil
+}
+
+// SetLevel changes current level, it can be called while messages are
+// logged.
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// Debugf logs message like log.Printf if current level is debug.
+func Debugf(format string, v ...any) {
+	if Level(level.Load()) <= LevelDebug {
+		log.Printf(format, v...)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package machine
+
+import "errors"
+
+func diskSpace(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("not supported on this platform")
+}
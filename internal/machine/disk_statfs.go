@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package machine
+
+import "syscall"
+
+// diskSpace returns space available to unprivileged users and total size of
+// filesystem containing path.
+func diskSpace(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,107 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+)
+
+// Heartbeat periodically reports liveness, current activity and resource
+// usage of the machine to web interface, independently of polling for
+// tasks, so web interface can tell busy machine from dead one.
+type Heartbeat struct {
+	client      *client.Client
+	interval    time.Duration
+	dataDirPath string
+
+	mu     sync.Mutex
+	busy   bool
+	taskID uint
+	stage  string
+}
+
+func NewHeartbeat(c *client.Client, interval time.Duration, dataDirPath string) *Heartbeat {
+	return &Heartbeat{
+		client:      c,
+		interval:    interval,
+		dataDirPath: dataDirPath,
+	}
+}
+
+// SetActivity records training task and its stage the machine is working
+// on, zero task ID means the machine is idle.
+func (h *Heartbeat) SetActivity(ttId uint, stage string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.taskID = ttId
+	h.stage = stage
+}
+
+// SetBusy records whether the machine runs training task issued by another
+// web interface, its details are not reported.
+func (h *Heartbeat) SetBusy(busy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.busy = busy
+}
+
+// Run sends heartbeats until ctx is done. It stops early if web interface
+// does not support heartbeats.
+func (h *Heartbeat) Run(ctx context.Context) {
+	if h.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		err := h.client.SendHeartbeat(ctx, h.payload())
+		var serverErr *client.ServerError
+		if errors.As(err, &serverErr) && (serverErr.StatusCode == http.StatusNotFound || serverErr.StatusCode == http.StatusMethodNotAllowed) {
+			log.Print("Web interface does not support heartbeats, stopping them")
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to send heartbeat. Error text: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Heartbeat) payload() *client.HeartbeatPayload {
+	h.mu.Lock()
+	heartbeat := &client.HeartbeatPayload{
+		Busy:   h.busy || h.taskID != 0,
+		TaskID: h.taskID,
+		Stage:  h.stage,
+	}
+	h.mu.Unlock()
+
+	// metrics which cannot be read are reported as zero
+	heartbeat.LoadAverage, _ = loadAverage()
+	total, available, err := memoryInfo()
+	if err == nil {
+		heartbeat.MemoryTotalBytes = total
+		heartbeat.MemoryUsedBytes = total - available
+	}
+	free, total, err := diskSpace(h.dataDirPath)
+	if err == nil {
+		heartbeat.DataDirTotalBytes = total
+		heartbeat.DataDirUsedBytes = total - free
+	}
+
+	return heartbeat
+}
@@ -0,0 +1,151 @@
+package machine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/pipeline"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+)
+
+// probeTimeout bounds every external command run to collect the inventory,
+// alienv in particular may be slow.
+const probeTimeout = 30 * time.Second
+
+// Collect gathers inventory of the machine. Values which cannot be
+// determined are logged and left empty, they never prevent the module from
+// starting.
+func Collect(ctx context.Context, cfg *config.Config, p *pipeline.Pipeline) *client.MachineInventory {
+	inventory := &client.MachineInventory{
+		CPUCount:  runtime.NumCPU(),
+		OS:        osDescription(),
+		GoVersion: runtime.Version(),
+	}
+	inventory.ModuleVersion, inventory.ModuleCommit = moduleVersion()
+
+	var err error
+	inventory.MemoryBytes, _, err = memoryInfo()
+	logProbeError("total memory", err)
+
+	inventory.DataDirFreeBytes, _, err = diskSpace(cfg.DataDirPath)
+	logProbeError("free disk space", err)
+
+	inventory.O2PhysicsVersion, err = o2PhysicsVersion(ctx)
+	logProbeError("O2Physics version", err)
+
+	inventory.PdiCommit, err = gitCommit(ctx, cfg.PdiDirPath)
+	logProbeError("pdi commit", err)
+
+	inventory.PythonPackages, err = pythonPackages(ctx, cfg.VenvDirPath)
+	logProbeError("Python packages", err)
+
+	for _, stageType := range pipeline.StageTypes {
+		inventory.StageTypes = append(inventory.StageTypes, string(stageType))
+	}
+	for _, command := range scripts.PdiCommands {
+		inventory.PdiCommands = append(inventory.PdiCommands, string(command))
+	}
+	for _, stage := range p.Stages {
+		inventory.PipelineStages = append(inventory.PipelineStages, stage.Name)
+	}
+
+	return inventory
+}
+
+func logProbeError(what string, err error) {
+	if err != nil {
+		log.Printf("Cannot determine %s of the machine. Error text: %s", what, err.Error())
+	}
+}
+
+func osDescription() string {
+	description := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+
+	file, err := os.Open("/etc/os-release")
+	if err != nil {
+		return description
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "PRETTY_NAME=")
+		if found {
+			return fmt.Sprintf("%s (%s)", description, strings.Trim(value, `"`))
+		}
+	}
+
+	return description
+}
+
+// moduleVersion returns version and VCS revision the module binary was built
+// from, revision is suffixed with "-dirty" for modified working tree.
+func moduleVersion() (string, string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", ""
+	}
+
+	var revision string
+	var modified bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+
+	return info.Main.Version, revision
+}
+
+func runProbe(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func o2PhysicsVersion(ctx context.Context) (string, error) {
+	return runProbe(ctx, "alienv", "setenv", "O2Physics/latest", "-c", "printenv", "O2PHYSICS_VERSION")
+}
+
+func gitCommit(ctx context.Context, dir string) (string, error) {
+	return runProbe(ctx, "git", "-C", dir, "rev-parse", "HEAD")
+}
+
+func pythonPackages(ctx context.Context, venvDir string) ([]client.PythonPackage, error) {
+	out, err := runProbe(ctx, filepath.Join(venvDir, "bin/python3"), "-m", "pip", "list", "--format=json", "--disable-pip-version-check")
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []client.PythonPackage
+	err = json.Unmarshal([]byte(out), &packages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pip list output: %w", err)
+	}
+
+	return packages, nil
+}
@@ -0,0 +1,65 @@
+package machine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// memoryInfo reads total and available memory from /proc/meminfo, so it
+// works on Linux only.
+func memoryInfo() (uint64, uint64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("malformed %s: %w", fields[0], err)
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = kb * 1024
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+	}
+
+	return total, values["MemAvailable"], nil
+}
+
+// loadAverage reads 1, 5 and 15 minute load averages from /proc/loadavg, so
+// it works on Linux only.
+func loadAverage() ([3]float64, error) {
+	var load [3]float64
+
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("malformed /proc/loadavg")
+	}
+	for i := range load {
+		load[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, fmt.Errorf("malformed /proc/loadavg: %w", err)
+		}
+	}
+
+	return load, nil
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+var ErrTaskCancelled = errors.New("training task cancelled on web interface")
+
+// watchCancellation periodically checks status of training task on web
+// interface and cancels ctx with ErrTaskCancelled cause once the task was
+// cancelled by user. It returns when ctx is done.
+func watchCancellation(ctx context.Context, c *client.Client, cfg *config.Config, ttId uint, cancel context.CancelCauseFunc) {
+	if cfg.CancellationCheckSeconds == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.CancellationCheckSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status, err := c.GetTaskStatus(ctx, ttId)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Training Task of id %d, cannot check status: %s", ttId, err.Error())
+			}
+			continue
+		}
+
+		if status == client.Cancelled {
+			log.Printf("Training Task of id %d, cancelled on web interface, aborting", ttId)
+			cancel(ErrTaskCancelled)
+			return
+		}
+	}
+}
+
+func cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrTaskCancelled)
+}
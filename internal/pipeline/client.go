@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+// LoadTLSConfig builds TLS configuration of clients from configuration.
+// Loaded certificates are returned too, so their expiry can be checked.
+func LoadTLSConfig(cfg *config.Config) (*tls.Config, []client.CertificateInfo, error) {
+	return client.LoadTLSConfig(client.TLSOptions{
+		CABundlePath:   cfg.TLSCABundlePath,
+		ClientCertPath: cfg.TLSClientCertPath,
+		ClientKeyPath:  cfg.TLSClientKeyPath,
+		MinVersion:     cfg.TLSMinVersion,
+	})
+}
+
+// NewClient creates client of web interface of server profile with timeouts,
+// retries, chunked uploads, request signing and proxy set in configuration.
+func NewClient(cfg *config.Config, profile config.ServerProfile, tlsConfig *tls.Config) (*client.Client, error) {
+	opts := []client.Option{
+		// transport of every client adjusts its TLS configuration, so
+		// clients cannot share it
+		client.WithTLSConfig(tlsConfig.Clone()),
+		client.WithRequestTimeout(time.Duration(cfg.RequestTimeoutSeconds) * time.Second),
+		client.WithUploadTimeout(time.Duration(cfg.UploadTimeoutSeconds) * time.Second),
+		client.WithRetries(int(cfg.RequestRetries), 500*time.Millisecond, 10*time.Second),
+		client.WithChunkedUploads(filepath.Join(StateDir(cfg, profile), "uploads"), int64(cfg.UploadChunkSizeMB)<<20),
+	}
+	if cfg.RequestSigning {
+		opts = append(opts, client.WithRequestSigning())
+	}
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		opts = append(opts, client.WithProxy(proxyURL))
+	}
+
+	return client.New(profile.BaseUrl, profile.MachineID, profile.MachineSecretKey, opts...), nil
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"errors"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+)
+
+// logTailLines is number of last lines of every stage's log file sent with
+// failure report.
+const logTailLines = 50
+
+// FailureError is failure of training task in a pipeline stage.
+type FailureError struct {
+	Stage   string
+	Class   scripts.ErrorClass
+	Err     error
+	LogTail string
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+func newFailureError(stage *Stage, command scripts.Command, class scripts.ErrorClass, err error) *FailureError {
+	return &FailureError{
+		Stage:   stage.Name,
+		Class:   class,
+		Err:     err,
+		LogTail: scripts.LogTail(logTailLines, command.LogPaths()...),
+	}
+}
+
+// NewFailureReport builds report of training task failure sent to the web
+// interface. Errors which did not happen in a stage are reported as internal.
+func NewFailureReport(err error) *client.FailureReport {
+	var failure *FailureError
+	if errors.As(err, &failure) {
+		return &client.FailureReport{
+			Stage:   failure.Stage,
+			Class:   string(failure.Class),
+			Message: failure.Error(),
+			LogTail: failure.LogTail,
+		}
+	}
+
+	return &client.FailureReport{
+		Class:   string(scripts.ErrorClassInternal),
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+)
+
+const (
+	TrainingConfigFileName = "train.json"
+)
+
+type StageType string
+
+const (
+	StageTypeGridDownload StageType = "grid-download"
+	StageTypeProducer     StageType = "producer"
+	StageTypePdi          StageType = "pdi"
+)
+
+// StageTypes lists stage types supported by the module.
+var StageTypes = []StageType{StageTypeGridDownload, StageTypeProducer, StageTypePdi}
+
+// stageSecrets lists secrets available to commands of stage types, other
+// secrets are never passed to them.
+var stageSecrets = map[StageType][]string{
+	StageTypeGridDownload: {config.SecretGridUserCert, config.SecretGridUserKey},
+}
+
+// Stage describes a single Command of the pipeline. Command is the name of
+// pdi command and is used only by stages of pdi type. Args may reference
+// variables (e.g. $TRAINING_CONFIG), which are expanded when the stage is
+// built. Status reported to the web interface while the stage is running
+// depends on its type, it can be overridden by Status field. Timeout is
+// optional duration (e.g. "12h") after which the stage is cancelled and the
+// task fails. Progress optionally overrides name of parser extracting
+// progress of the stage from its output.
+type Stage struct {
+	Name     string    `json:"name"`
+	Type     StageType `json:"type"`
+	Command  string    `json:"command,omitempty"`
+	Args     []string  `json:"args,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Timeout  string    `json:"timeout,omitempty"`
+	Progress string    `json:"progress,omitempty"`
+}
+
+// Pipeline is ordered list of stages. OnStage, if set, is called before
+// each stage of training task is run.
+type Pipeline struct {
+	Stages  []Stage                           `json:"stages"`
+	OnStage func(ttId uint, stageName string) `json:"-"`
+}
+
+func TrainingConfigPath(cfg *config.Config) string {
+	return filepath.Join(cfg.DataDirPath, TrainingConfigFileName)
+}
+
+func variables(cfg *config.Config) map[string]string {
+	return map[string]string{
+		"DATA_DIR":          cfg.DataDirPath,
+		"RESULTS_DIR":       cfg.ResultsDirPath,
+		"SCRIPTS_DIR":       cfg.ScriptsDirPath,
+		"TRAINING_CONFIG":   TrainingConfigPath(cfg),
+		"PREPROCESSED_ROOT": filepath.Join(cfg.DataDirPath, fmt.Sprintf("%s.root", scripts.PreprocessedAodFileName)),
+	}
+}
+
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline file: %w", err)
+	}
+
+	var p Pipeline
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline file %s: %w", path, err)
+	}
+
+	err = p.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline file %s: %w", path, err)
+	}
+
+	return &p, nil
+}
+
+func (p *Pipeline) Validate() error {
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("pipeline has no stages")
+	}
+
+	var errs []error
+	names := make(map[string]bool)
+	for i, stage := range p.Stages {
+		if stage.Name == "" {
+			errs = append(errs, fmt.Errorf("stage %d: name is empty", i))
+		} else if names[stage.Name] {
+			errs = append(errs, fmt.Errorf("stage %d: duplicated name %q", i, stage.Name))
+		}
+		names[stage.Name] = true
+
+		err := stage.validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stage %q: %w", stage.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Stage) validate() error {
+	switch s.Type {
+	case StageTypeGridDownload, StageTypeProducer:
+		if s.Command != "" || len(s.Args) != 0 {
+			return fmt.Errorf("%s stage takes neither command nor arguments", s.Type)
+		}
+	case StageTypePdi:
+		if !scripts.PdiCommand(s.Command).IsValid() {
+			return fmt.Errorf("unknown pdi command %q", s.Command)
+		}
+	default:
+		return fmt.Errorf("unknown stage type %q", s.Type)
+	}
+
+	known := variables(&config.Config{})
+	for _, arg := range s.Args {
+		var unknown []string
+		os.Expand(arg, func(name string) string {
+			if _, ok := known[name]; !ok {
+				unknown = append(unknown, name)
+			}
+			return ""
+		})
+		if len(unknown) != 0 {
+			return fmt.Errorf("unknown variables %v in argument %q", unknown, arg)
+		}
+	}
+
+	if s.Timeout != "" {
+		timeout, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout must be positive")
+		}
+	}
+
+	if s.Progress != "" {
+		_, err := scripts.NewProgressParser(s.Progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Status != "" {
+		status, err := client.ParseTrainingTaskStatus(s.Status)
+		if err != nil {
+			return err
+		}
+		if !status.IsActive() {
+			return fmt.Errorf("status %s cannot be reported for a stage", status)
+		}
+	}
+
+	return nil
+}
+
+// status returns status reported to the web interface while the stage is
+// running.
+func (s *Stage) status() client.TrainingTaskStatus {
+	if s.Status != "" {
+		status, _ := client.ParseTrainingTaskStatus(s.Status)
+		return status
+	}
+
+	switch s.Type {
+	case StageTypeGridDownload:
+		return client.Downloading
+	case StageTypeProducer:
+		return client.Producing
+	}
+
+	switch scripts.PdiCommand(s.Command) {
+	case scripts.PdiCommandProcess:
+		return client.Processing
+	case scripts.PdiCommandDataExploration:
+		return client.Exploring
+	case scripts.PdiCommandBenchmark:
+		return client.Benchmarking
+	}
+
+	return client.Training
+}
+
+// timeout returns the stage timeout, zero means no timeout.
+func (s *Stage) timeout() time.Duration {
+	timeout, _ := time.ParseDuration(s.Timeout)
+	return timeout
+}
+
+// NewCommand builds Command executing the stage for given training task.
+func (s *Stage) NewCommand(cfg *config.Config, uploader scripts.ResultUploader, tt *client.TrainingTaskResponse) scripts.Command {
+	vars := variables(cfg)
+	args := make([]string, 0, len(s.Args))
+	for _, arg := range s.Args {
+		args = append(args, os.Expand(arg, func(name string) string {
+			return vars[name]
+		}))
+	}
+
+	var command scripts.Command
+	switch s.Type {
+	case StageTypeGridDownload:
+		command = scripts.NewGridDownloadRunner(cfg, uploader, config.RestrictSecrets(cfg.Secrets(), stageSecrets[s.Type]...), tt.AODFiles)
+	case StageTypeProducer:
+		command = scripts.NewProducerRunner(cfg, uploader)
+	case StageTypePdi:
+		command = scripts.NewPdiRunner(scripts.PdiCommand(s.Command), cfg, uploader, args...)
+	}
+
+	if reporter, ok := command.(scripts.ProgressReporter); ok && s.Progress != "" {
+		parser, _ := scripts.NewProgressParser(s.Progress)
+		reporter.SetProgressParser(parser)
+	}
+
+	return command
+}
@@ -0,0 +1,124 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+)
+
+// progressReportInterval limits how often progress of the running stage is
+// logged and sent to the web interface.
+const progressReportInterval = 30 * time.Second
+
+// progressForwarder collects progress parsed from output of the stage's
+// command and periodically forwards the latest one. Parsing happens while
+// the command output is copied, so it must never wait for the web interface.
+// Progress is always logged, but sent directly, not journaled, and only when
+// the spool is idle, so it never overtakes status updates waiting in the
+// spool.
+type progressForwarder struct {
+	client  *client.Client
+	spool   *spool.Spool
+	ttId    uint
+	stage   *Stage
+	message string
+
+	mu     sync.Mutex
+	latest *scripts.Progress
+}
+
+// forwardProgress starts forwarding progress of command, if it can report
+// it. Returned function stops forwarding.
+func forwardProgress(ctx context.Context, c *client.Client, out *spool.Spool, ttId uint, stage *Stage, command scripts.Command, message string) func() {
+	reporter, ok := command.(scripts.ProgressReporter)
+	if !ok {
+		return func() {}
+	}
+
+	f := &progressForwarder{
+		client:  c,
+		spool:   out,
+		ttId:    ttId,
+		stage:   stage,
+		message: message,
+	}
+	reporter.SetProgressFunc(f.update)
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f.run(ctx)
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (f *progressForwarder) update(progress scripts.Progress) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.latest = &progress
+}
+
+func (f *progressForwarder) run(ctx context.Context) {
+	ticker := time.NewTicker(progressReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		f.mu.Lock()
+		progress := f.latest
+		f.latest = nil
+		f.mu.Unlock()
+
+		if progress == nil {
+			continue
+		}
+
+		message := f.format(progress)
+		log.Printf("Training Task of id %d, %.1f%%: %s", f.ttId, progress.Percent, message)
+		if f.spool.Idle() {
+			f.send(ctx, progress, message)
+		}
+	}
+}
+
+func (f *progressForwarder) format(progress *scripts.Progress) string {
+	message := f.message
+	if progress.Message != "" {
+		message = fmt.Sprintf("%s, %s", message, progress.Message)
+	}
+	if progress.ETA > 0 {
+		message = fmt.Sprintf("%s, ETA %s", message, progress.ETA)
+	}
+
+	return message
+}
+
+func (f *progressForwarder) send(ctx context.Context, progress *scripts.Progress, message string) {
+	percent := progress.Percent
+	err := f.client.UpdateTaskStatusWithPayload(ctx, f.ttId, &client.UpdateTaskStatusPayload{
+		Status:   f.stage.status(),
+		Progress: &percent,
+		Message:  message,
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Training Task of id %d, failed to report progress: %s", f.ttId, err.Error())
+	}
+}
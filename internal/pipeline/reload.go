@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ReloadTimeouts loads pipeline file at path again and applies new timeouts
+// to stages of the same name. Other changes of the file are applied only
+// after restart of the module, ignored reports whether there were any.
+// Returned changes describe applied timeouts.
+func (p *Pipeline) ReloadTimeouts(path string) (changes []string, ignored bool, err error) {
+	newP, err := Load(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ignored = len(newP.Stages) != len(p.Stages)
+	newStages := make(map[string]Stage)
+	for i, stage := range newP.Stages {
+		newStages[stage.Name] = stage
+		if i < len(p.Stages) && p.Stages[i].Name != stage.Name {
+			ignored = true
+		}
+	}
+
+	for i := range p.Stages {
+		stage := &p.Stages[i]
+		newStage, ok := newStages[stage.Name]
+		if !ok {
+			ignored = true
+			continue
+		}
+
+		if stage.Timeout != newStage.Timeout {
+			changes = append(changes, fmt.Sprintf("stage %s timeout: %q -> %q", stage.Name, stage.Timeout, newStage.Timeout))
+			stage.Timeout = newStage.Timeout
+		}
+		if !reflect.DeepEqual(*stage, newStage) {
+			ignored = true
+		}
+	}
+
+	return changes, ignored, nil
+}
@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+)
+
+// Run executes stages of the pipeline for training task of given state,
+// stopping at the first failing one. Stages already finished according to
+// the state are skipped and the state is saved after every step, so the
+// execution can be resumed after restart. Logs of the stage are uploaded
+// even if it failed or was interrupted by cancellation of ctx. If the task
+// is cancelled on web interface meanwhile, running stage is aborted and
+// ErrTaskCancelled is returned. Status of every stage is reported to the web
+// interface before it is run. Status updates and uploads of logs and results
+// are journaled in the spool, which delivers them once the web interface is
+// reachable.
+// Failure of a stage or of uploading its results is returned as FailureError.
+// Outcome of finished task is recorded in its state, it is left for the
+// caller to report it.
+func (p *Pipeline) Run(ctx context.Context, c *client.Client, out *spool.Spool, cfg *config.Config, state *TaskState) error {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go watchCancellation(runCtx, c, cfg, state.Task.ID, cancel)
+
+	err := p.run(runCtx, c, out, cfg, state)
+	if err != nil && cancelled(runCtx) {
+		return ErrTaskCancelled
+	}
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+
+	if err != nil {
+		state.Fail(err)
+	} else {
+		state.Complete()
+	}
+
+	return errors.Join(err, state.Save())
+}
+
+func (p *Pipeline) run(ctx context.Context, c *client.Client, out *spool.Spool, cfg *config.Config, state *TaskState) error {
+	tt := &state.Task
+	var uploadFailure error
+
+	for i, stage := range p.Stages {
+		stageState := state.stage(stage.Name)
+		if stageState.done() {
+			log.Printf("Training Task of id %d, skipping already finished stage %s", tt.ID, stage.Name)
+			continue
+		}
+
+		if p.OnStage != nil {
+			p.OnStage(tt.ID, stage.Name)
+		}
+
+		command := stage.NewCommand(cfg, out, tt)
+
+		if !stageState.Completed {
+			message := fmt.Sprintf("Stage %d of %d: %s", i+1, len(p.Stages), stage.Name)
+			err := out.UpdateTaskStatusWithPayload(ctx, tt.ID, &client.UpdateTaskStatusPayload{
+				Status:  stage.status(),
+				Message: message,
+			})
+			if err != nil {
+				log.Printf("Training Task of id %d, failed to report status of stage %s: %s", tt.ID, stage.Name, err.Error())
+			}
+
+			stopProgress := forwardProgress(ctx, c, out, tt.ID, &stage, command, message)
+			err = runStage(ctx, &stage, command)
+			stopProgress()
+			if err != nil {
+				if !cancelled(ctx) {
+					uploadCtx, cancel := CleanupContext(ctx, cfg)
+					command.UploadLogs(uploadCtx, tt.ID)
+					cancel()
+				}
+				return err
+			}
+
+			stageState.Completed = true
+			err = state.Save()
+			if err != nil {
+				return err
+			}
+		}
+
+		if !stageState.LogsUploaded {
+			err := command.UploadLogs(ctx, tt.ID)
+			if err != nil {
+				log.Printf("Training Task of id %d, failed to upload logs of stage %s: %s", tt.ID, stage.Name, err.Error())
+			} else {
+				stageState.LogsUploaded = true
+			}
+		}
+
+		if !stageState.ResultsUploaded {
+			err := command.UploadResults(ctx, tt.ID)
+			if err != nil {
+				log.Printf("Training Task of id %d, failed to upload results of stage %s: %s", tt.ID, stage.Name, err.Error())
+				if uploadFailure == nil {
+					err = fmt.Errorf("failed to upload results of stage %s: %w", stage.Name, err)
+					uploadFailure = newFailureError(&stage, command, scripts.ErrorClassUpload, err)
+				}
+			} else {
+				stageState.ResultsUploaded = true
+			}
+		}
+
+		err := state.Save()
+		if err != nil {
+			return err
+		}
+	}
+
+	return uploadFailure
+}
+
+// CleanupContext returns context for work which must be done even if ctx was
+// cancelled by shutdown request (e.g. uploading partial logs). In such case
+// the work is bounded by shutdown grace period.
+func CleanupContext(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return context.WithCancel(ctx)
+	}
+
+	grace := time.Duration(cfg.ShutdownGraceSeconds) * time.Second
+	return context.WithTimeout(context.WithoutCancel(ctx), grace)
+}
+
+var errStageTimeout = errors.New("stage timeout")
+
+func runStage(ctx context.Context, stage *Stage, command scripts.Command) error {
+	timeout := stage.timeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, errStageTimeout)
+		defer cancel()
+	}
+
+	err := command.Run(ctx)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(context.Cause(ctx), errStageTimeout) {
+		err = fmt.Errorf("stage %s timed out after %s", stage.Name, timeout)
+		return newFailureError(stage, command, scripts.ErrorClassTimeout, err)
+	}
+
+	class := scripts.ErrorClassOf(err)
+	return newFailureError(stage, command, class, fmt.Errorf("stage %s failed: %w", stage.Name, err))
+}
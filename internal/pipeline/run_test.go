@@ -0,0 +1,213 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+)
+
+// fakePython records its third argument, the stage name, in runs file of
+// data directory. Stage fails if the next argument is fail and hangs if it
+// is hang.
+const fakePython = `#!/bin/sh
+echo "$3" >> "$DATA_DIR/runs"
+case "$4" in
+fail) exit 1 ;;
+hang) sleep 10 ;;
+esac
+`
+
+type runTest struct {
+	cfg   *config.Config
+	c     *client.Client
+	out   *spool.Spool
+	state *TaskState
+}
+
+// newRunTest prepares workspace with fake pdi interpreter and saved state of
+// training task with given stages progress.
+func newRunTest(t *testing.T, stages []StageState) *runTest {
+	t.Helper()
+	root := t.TempDir()
+	cfg := &config.Config{
+		DataDirPath:          filepath.Join(root, "data"),
+		ResultsDirPath:       filepath.Join(root, "results"),
+		ScriptsDirPath:       filepath.Join(root, "scripts"),
+		VenvDirPath:          filepath.Join(root, "venv"),
+		StateDirPath:         filepath.Join(root, "state"),
+		ShutdownGraceSeconds: 1,
+	}
+	for _, dir := range []string{cfg.DataDirPath, cfg.ResultsDirPath, cfg.StateDirPath, filepath.Join(cfg.VenvDirPath, "bin")} {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.WriteFile(filepath.Join(cfg.VenvDirPath, "bin/python3"), []byte(fakePython), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// logs left by stages run before restart
+	for _, name := range []string{"pdi_process_out.log", "pdi_process_err.log"} {
+		err = os.WriteFile(filepath.Join(cfg.ResultsDirPath, name), nil, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := client.New("http://127.0.0.1:1", 1, "secret")
+	out, err := spool.New(filepath.Join(root, "spool"), c, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := NewState(cfg.StateDirPath, &client.TrainingTaskResponse{ID: 1})
+	state.Stages = stages
+	err = state.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &runTest{cfg: cfg, c: c, out: out, state: state}
+}
+
+func (r *runTest) runs(t *testing.T) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(r.cfg.DataDirPath, "runs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Fields(string(data))
+}
+
+func doneStage(name string) StageState {
+	return StageState{Name: name, Completed: true, LogsUploaded: true, ResultsUploaded: true}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		stages    []StageState
+		behaviour map[string]string
+		timeout   string
+		interrupt bool
+		wantRuns  []string
+		// wantStatus is outcome of the task, nil if it is not finished
+		wantStatus *client.TrainingTaskStatus
+		wantClass  scripts.ErrorClass
+		wantStages []StageState
+	}{
+		{
+			name:       "all stages run",
+			wantRuns:   []string{"first", "second", "third"},
+			wantStatus: statusOf(client.Completed),
+			wantStages: []StageState{doneStage("first"), doneStage("second"), doneStage("third")},
+		},
+		{
+			name:       "finished stages skipped",
+			stages:     []StageState{doneStage("first"), doneStage("second")},
+			wantRuns:   []string{"third"},
+			wantStatus: statusOf(client.Completed),
+			wantStages: []StageState{doneStage("first"), doneStage("second"), doneStage("third")},
+		},
+		{
+			name:       "completed stage with artifacts not uploaded is not run again",
+			stages:     []StageState{{Name: "first", Completed: true}},
+			wantRuns:   []string{"second", "third"},
+			wantStatus: statusOf(client.Completed),
+			wantStages: []StageState{doneStage("first"), doneStage("second"), doneStage("third")},
+		},
+		{
+			name:       "failed stage stops pipeline",
+			behaviour:  map[string]string{"second": "fail"},
+			wantRuns:   []string{"first", "second"},
+			wantStatus: statusOf(client.Failed),
+			wantClass:  scripts.ErrorClassCommandFailed,
+			wantStages: []StageState{doneStage("first"), {Name: "second"}},
+		},
+		{
+			name:       "stage timed out",
+			behaviour:  map[string]string{"first": "hang"},
+			timeout:    "100ms",
+			wantRuns:   []string{"first"},
+			wantStatus: statusOf(client.Failed),
+			wantClass:  scripts.ErrorClassTimeout,
+			wantStages: []StageState{{Name: "first"}},
+		},
+		{
+			name:       "interrupted task is not finished",
+			stages:     []StageState{doneStage("first")},
+			behaviour:  map[string]string{"second": "hang"},
+			interrupt:  true,
+			wantRuns:   []string{"second"},
+			wantStages: []StageState{doneStage("first")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRunTest(t, test.stages)
+			p := &Pipeline{}
+			for _, name := range []string{"first", "second", "third"} {
+				stage := Stage{Name: name, Type: StageTypePdi, Command: string(scripts.PdiCommandProcess), Args: []string{name}}
+				if behaviour, ok := test.behaviour[name]; ok {
+					stage.Args = append(stage.Args, behaviour)
+					stage.Timeout = test.timeout
+				}
+				p.Stages = append(p.Stages, stage)
+			}
+
+			ctx := context.Background()
+			if test.interrupt {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+				defer cancel()
+			}
+
+			err := p.Run(ctx, r.c, r.out, r.cfg, r.state)
+			if (err != nil) != (test.wantStatus == nil || *test.wantStatus == client.Failed) {
+				t.Errorf("Run error = %v", err)
+			}
+			if got := r.runs(t); !reflect.DeepEqual(got, test.wantRuns) {
+				t.Errorf("run stages %v, want %v", got, test.wantRuns)
+			}
+
+			state, err := LoadState(r.cfg.StateDirPath, 1)
+			if err != nil || state == nil {
+				t.Fatalf("LoadState = %v, %v", state, err)
+			}
+			if !reflect.DeepEqual(state.Stages, test.wantStages) {
+				t.Errorf("saved stages %+v, want %+v", state.Stages, test.wantStages)
+			}
+			switch {
+			case test.wantStatus == nil:
+				if state.Finished() {
+					t.Errorf("saved outcome %+v, want none", state.Outcome)
+				}
+			case !state.Finished() || state.Outcome.Status != *test.wantStatus:
+				t.Errorf("saved outcome %+v, want status %s", state.Outcome, test.wantStatus)
+			case test.wantClass != "" && (state.Outcome.Failure == nil || state.Outcome.Failure.Class != string(test.wantClass)):
+				t.Errorf("saved failure %+v, want class %s", state.Outcome.Failure, test.wantClass)
+			}
+		})
+	}
+}
+
+func statusOf(status client.TrainingTaskStatus) *client.TrainingTaskStatus {
+	return &status
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/spool"
+)
+
+const (
+	stateFilePrefix = "task-"
+	stateFileSuffix = ".json"
+)
+
+// StageState records progress of a single stage. Stage is skipped on resume
+// only when it completed and all its artifacts were uploaded.
+type StageState struct {
+	Name            string
+	Completed       bool
+	LogsUploaded    bool
+	ResultsUploaded bool
+}
+
+func (s *StageState) done() bool {
+	return s.Completed && s.LogsUploaded && s.ResultsUploaded
+}
+
+// TaskState is checkpoint of training task execution persisted in state
+// directory, so the task can be resumed after the module restart. Outcome is
+// final status of finished task, it is kept until it is reported to the web
+// interface.
+type TaskState struct {
+	Task    client.TrainingTaskResponse
+	Stages  []StageState
+	Outcome *client.UpdateTaskStatusPayload `json:",omitempty"`
+
+	path string
+}
+
+// StateDir returns directory with checkpoints of training tasks issued by
+// web interface of server profile.
+func StateDir(cfg *config.Config, profile config.ServerProfile) string {
+	return profile.Dir(cfg.StateDirPath)
+}
+
+func statePath(dir string, ttId uint) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", stateFilePrefix, ttId, stateFileSuffix))
+}
+
+func NewState(dir string, tt *client.TrainingTaskResponse) *TaskState {
+	return &TaskState{
+		Task: *tt,
+		path: statePath(dir, tt.ID),
+	}
+}
+
+// LoadState reads checkpoint of training task from state directory dir, it
+// returns nil if there is none.
+func LoadState(dir string, ttId uint) (*TaskState, error) {
+	path := statePath(dir, ttId)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task state: %w", err)
+	}
+
+	var state TaskState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse task state %s: %w", path, err)
+	}
+	state.path = path
+
+	return &state, nil
+}
+
+// ListStates returns ids of training tasks with persisted checkpoint in
+// state directory dir.
+func ListStates(dir string) ([]uint, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	var ids []uint
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, stateFilePrefix) || !strings.HasSuffix(name, stateFileSuffix) {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, stateFilePrefix), stateFileSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (s *TaskState) Finished() bool {
+	return s.Outcome != nil
+}
+
+func (s *TaskState) Complete() {
+	s.Outcome = &client.UpdateTaskStatusPayload{
+		Status: client.Completed,
+	}
+}
+
+func (s *TaskState) Fail(err error) {
+	s.Outcome = &client.UpdateTaskStatusPayload{
+		Status:  client.Failed,
+		Failure: NewFailureReport(err),
+	}
+}
+
+// ReportOutcome journals final status of finished task in the spool, which
+// delivers it to the web interface.
+func (s *TaskState) ReportOutcome(ctx context.Context, out *spool.Spool) error {
+	return out.UpdateTaskStatusWithPayload(ctx, s.Task.ID, s.Outcome)
+}
+
+// Restart clears progress of the task, so all its stages are run again when
+// it is resumed, e.g. after its workspace was wiped for another task.
+func (s *TaskState) Restart() error {
+	s.Stages = nil
+	return s.Save()
+}
+
+func (s *TaskState) stage(name string) *StageState {
+	for i := range s.Stages {
+		if s.Stages[i].Name == name {
+			return &s.Stages[i]
+		}
+	}
+
+	s.Stages = append(s.Stages, StageState{Name: name})
+	return &s.Stages[len(s.Stages)-1]
+}
+
+// Save atomically replaces persisted checkpoint, so the state file is never
+// left half-written if the module is killed.
+func (s *TaskState) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal task state: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open task state file: %w", err)
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write task state file: %w", err)
+	}
+
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace task state file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TaskState) Remove() error {
+	err := os.Remove(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove task state file: %w", err)
+	}
+
+	return nil
+}
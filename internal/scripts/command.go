@@ -1,7 +1,53 @@
 package scripts
 
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+// killGracePeriod is time given to the process group of cancelled command to
+// exit after SIGTERM, before it is killed.
+const killGracePeriod = 10 * time.Second
+
+// ResultUploader uploads files produced by commands to the web interface.
+type ResultUploader interface {
+	UploadTaskResult(ctx context.Context, ttId uint, ttr *client.TaskResultPayload) error
+}
+
 type Command interface {
-	Run() error
-	UploadLogs(ttId uint) error
-	UploadResults(ttId uint) error
+	Run(ctx context.Context) error
+	UploadLogs(ctx context.Context, ttId uint) error
+	UploadResults(ctx context.Context, ttId uint) error
+	LogPaths() []string
+}
+
+// newCommand creates command run in its own process group, so all its
+// children (e.g. processes spawned by bash -c) are terminated together with
+// it when ctx is done. Configuration of the module, including its secrets, is
+// removed from environment of the command.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = 2 * killGracePeriod
+	cmd.Env = commandEnv()
+
+	return cmd
+}
+
+func commandEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if !config.IsModuleEnv(key) {
+			env = append(env, kv)
+		}
+	}
+
+	return env
 }
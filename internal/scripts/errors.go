@@ -0,0 +1,123 @@
+package scripts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ErrorClass is a category of stage failure reported to the web interface.
+type ErrorClass string
+
+const (
+	ErrorClassGridAuth           ErrorClass = "grid-auth"
+	ErrorClassMissingFiles       ErrorClass = "missing-files"
+	ErrorClassProducerCrash      ErrorClass = "producer-crash"
+	ErrorClassEmptyDataset       ErrorClass = "empty-dataset"
+	ErrorClassTrainingDivergence ErrorClass = "training-divergence"
+	ErrorClassUpload             ErrorClass = "upload"
+	ErrorClassCommandFailed      ErrorClass = "command-failed"
+	ErrorClassTimeout            ErrorClass = "timeout"
+	ErrorClassInterrupted        ErrorClass = "interrupted"
+	ErrorClassInvalidConfig      ErrorClass = "invalid-configuration"
+	ErrorClassInternal           ErrorClass = "internal"
+)
+
+// StageError is a failure of command classified by its cause.
+type StageError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+func newStageError(class ErrorClass, format string, args ...any) error {
+	return &StageError{Class: class, Err: fmt.Errorf(format, args...)}
+}
+
+// ErrorClassOf returns class of err, ErrorClassCommandFailed if it is not
+// classified.
+func ErrorClassOf(err error) ErrorClass {
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return stageErr.Class
+	}
+
+	return ErrorClassCommandFailed
+}
+
+var (
+	gridAuthPattern     = regexp.MustCompile(`(?i)(token|certificate|authenticat|x509|proxy)\S*\b.*\b(invalid|expired|not found|failed|error|denied)`)
+	divergencePattern   = regexp.MustCompile(`(?i)loss[^\n]*\b(nan|inf)\b`)
+	emptyDatasetPattern = regexp.MustCompile(`(?i)(EmptyDataError|no columns to parse|empty dataset|\b0 rows\b)`)
+	missingFilePattern  = regexp.MustCompile(`(FileNotFoundError|No such file or directory)`)
+)
+
+// logsMatch reports whether any of log files contains line matching pattern.
+func logsMatch(pattern *regexp.Regexp, paths ...string) bool {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if pattern.Match(data) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxLogTailSize bounds the part of log file read for its tail.
+const maxLogTailSize = 16 * 1024
+
+// LogTail returns last lines of log files, each prefixed with its name.
+func LogTail(lines int, paths ...string) string {
+	var sb strings.Builder
+	for _, path := range paths {
+		tail, err := fileTail(path, lines)
+		if err != nil || tail == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "==> %s <==\n%s\n", path, tail)
+	}
+
+	return sb.String()
+}
+
+func fileTail(path string, lines int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	offset := max(0, info.Size()-maxLogTailSize)
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return "", err
+	}
+
+	data = bytes.TrimRight(data, "\r\n")
+	parts := strings.Split(string(data), "\n")
+	if len(parts) > lines {
+		parts = parts[len(parts)-lines:]
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
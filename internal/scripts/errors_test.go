@@ -0,0 +1,76 @@
+package scripts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPdiClassifyError(t *testing.T) {
+	tests := []struct {
+		name    string
+		command PdiCommand
+		stderr  string
+		stdout  string
+		want    ErrorClass
+	}{
+		{"loss nan", PdiCommandTrain, "", "Epoch 3/10 loss: nan", ErrorClassTrainingDivergence},
+		{"validation loss inf", PdiCommandTrain, "val_loss=Inf\n", "", ErrorClassTrainingDivergence},
+		{"nan outside of loss", PdiCommandTrain, "RuntimeWarning: invalid value, result is nan\n", "", ErrorClassCommandFailed},
+		{"inf in path", PdiCommandTrain, "Traceback:\n  File \"/opt/inf/train.py\"\nValueError\n", "", ErrorClassCommandFailed},
+		{"loss nan of other command", PdiCommandBenchmark, "loss: nan\n", "", ErrorClassCommandFailed},
+		{"empty data error", PdiCommandProcess, "pandas.errors.EmptyDataError: No columns to parse from file\n", "", ErrorClassEmptyDataset},
+		{"zero rows", PdiCommandProcess, "", "Loaded 0 rows\n", ErrorClassEmptyDataset},
+		{"hundred rows", PdiCommandProcess, "KeyError: 'fPt'\n", "Loaded 100 rows\n", ErrorClassCommandFailed},
+		{"ten rows", PdiCommandProcess, "", "Processed 10 rows, failed\n", ErrorClassCommandFailed},
+		{"missing file", PdiCommandProcess, "FileNotFoundError: [Errno 2] No such file or directory: 'AO2D.root'\n", "", ErrorClassMissingFiles},
+		{"missing file only in stdout", PdiCommandProcess, "", "No such file or directory\n", ErrorClassCommandFailed},
+		{"unknown", PdiCommandDataExploration, "Segmentation fault\n", "", ErrorClassCommandFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := &PdiRunner{
+				Command:    test.command,
+				LogErrPath: filepath.Join(dir, "err.log"),
+				LogOutPath: filepath.Join(dir, "out.log"),
+			}
+			for path, content := range map[string]string{p.LogErrPath: test.stderr, p.LogOutPath: test.stdout} {
+				err := os.WriteFile(path, []byte(content), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cause := errors.New("exit status 1")
+			err := p.classifyError(cause)
+			if got := ErrorClassOf(err); got != test.want {
+				t.Errorf("class = %s, want %s", got, test.want)
+			}
+			if !errors.Is(err, cause) {
+				t.Errorf("classified error %v does not wrap cause", err)
+			}
+		})
+	}
+}
+
+func TestGridAuthPattern(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"Error: certificate has expired", true},
+		{"x509 certificate expired", true},
+		{"Token is invalid or expired", true},
+		{"Authentication failed for user", true},
+		{"Downloading /alice/sim/2024/AO2D.root", false},
+	}
+
+	for _, test := range tests {
+		if got := gridAuthPattern.MatchString(test.line); got != test.want {
+			t.Errorf("gridAuthPattern.MatchString(%q) = %v, want %v", test.line, got, test.want)
+		}
+	}
+}
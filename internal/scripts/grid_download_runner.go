@@ -2,10 +2,11 @@ package scripts
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -14,40 +15,53 @@ import (
 )
 
 const (
-	RemoteListName     = "remote_list.txt"
-	LocalListName      = "local_list.txt"
-	RawAodsSUbdir      = "raw_ao2ds"
-	DownloadScriptName = "download-from-grid.sh"
+	RemoteListName        = "remote_list.txt"
+	LocalListName         = "local_list.txt"
+	RawAodsSUbdir         = "raw_ao2ds"
+	DownloadScriptName    = "download-from-grid.sh"
 	GenerateRunScriptName = "generate-run-pidml-producer-script.py"
 )
 
 type GridDownloadRunner struct {
 	*config.Config
-	AODFiles       []client.AODFile
-	LogErrPath     string
-	LogOutPath     string
-	RemoteListPath string
-	LocalListPath  string
-	AodsOutputDir  string
-	ScriptPath     string
+	progressReporting
+	Uploader                    ResultUploader
+	Secrets                     config.SecretProvider
+	AODFiles                    []client.AODFile
+	LogErrPath                  string
+	LogOutPath                  string
+	RemoteListPath              string
+	LocalListPath               string
+	AodsOutputDir               string
+	ScriptPath                  string
 	PIDMLProducerGenerateScript string
 }
 
-func NewGridDownloadRunner(cfg *config.Config, aodFiles []client.AODFile) *GridDownloadRunner {
+// NewGridDownloadRunner creates runner downloading AOD files from GRID.
+// GRID certificate and key are read from secrets, if they are not there,
+// alien tools use ~/.globus of the user.
+func NewGridDownloadRunner(cfg *config.Config, uploader ResultUploader, secrets config.SecretProvider, aodFiles []client.AODFile) *GridDownloadRunner {
 	return &GridDownloadRunner{
-		Config:         cfg,
-		AODFiles:       aodFiles,
-		LogErrPath:     filepath.Join(cfg.DataDirPath, "grid_download_err.log"),
-		LogOutPath:     filepath.Join(cfg.DataDirPath, "grid_download_out.log"),
-		RemoteListPath: filepath.Join(cfg.DataDirPath, RemoteListName),
-		LocalListPath:  filepath.Join(cfg.DataDirPath, LocalListName),
-		AodsOutputDir:  filepath.Join(cfg.DataDirPath, RawAodsSUbdir),
-		ScriptPath:     filepath.Join(cfg.ScriptsDirPath, DownloadScriptName),
+		Config:                      cfg,
+		progressReporting:           progressReporting{parser: GridDownloadProgressParser()},
+		Uploader:                    uploader,
+		Secrets:                     secrets,
+		AODFiles:                    aodFiles,
+		LogErrPath:                  filepath.Join(cfg.DataDirPath, "grid_download_err.log"),
+		LogOutPath:                  filepath.Join(cfg.DataDirPath, "grid_download_out.log"),
+		RemoteListPath:              filepath.Join(cfg.DataDirPath, RemoteListName),
+		LocalListPath:               filepath.Join(cfg.DataDirPath, LocalListName),
+		AodsOutputDir:               filepath.Join(cfg.DataDirPath, RawAodsSUbdir),
+		ScriptPath:                  filepath.Join(cfg.ScriptsDirPath, DownloadScriptName),
 		PIDMLProducerGenerateScript: filepath.Join(cfg.ScriptsDirPath, GenerateRunScriptName),
 	}
 }
 
-func (r *GridDownloadRunner) Run() error {
+func (r *GridDownloadRunner) Run(ctx context.Context) error {
+	if len(r.AODFiles) == 0 {
+		return newStageError(ErrorClassEmptyDataset, "training task has no AOD files")
+	}
+
 	err := r.prepareFileList()
 	if err != nil {
 		return fmt.Errorf("failed to prepare remote list file: %w", err)
@@ -58,27 +72,37 @@ func (r *GridDownloadRunner) Run() error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	logErr, err := os.OpenFile(r.LogErrPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	logErr, err := os.OpenFile(r.LogErrPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer logErr.Close()
-	logOut, err := os.OpenFile(r.LogOutPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	logOut, err := os.OpenFile(r.LogOutPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer logOut.Close()
 
-	multiWriterOut := io.MultiWriter(logOut, os.Stdout)
-	multiWriterErr := io.MultiWriter(logOut, os.Stderr)
+	multiWriterOut := r.progressWriter(io.MultiWriter(logOut, os.Stdout))
+	multiWriterErr := r.progressWriter(io.MultiWriter(logErr, os.Stderr))
 
-	cmd := exec.Command("alienv", "setenv", "xjalienfs/latest", "-c", r.ScriptPath, r.RemoteListPath, r.AodsOutputDir)
+	credentialsEnv, cleanup, err := r.gridCredentials()
+	if err != nil {
+		return newStageError(ErrorClassGridAuth, "cannot load GRID credentials: %w", err)
+	}
+	defer cleanup()
+
+	cmd := newCommand(ctx, "alienv", "setenv", "xjalienfs/latest", "-c", r.ScriptPath, r.RemoteListPath, r.AodsOutputDir)
+	cmd.Env = append(cmd.Env, credentialsEnv...)
 	cmd.Stdout = multiWriterOut
 	cmd.Stderr = multiWriterErr
 
 	err = cmd.Run()
 	if err != nil {
-		return fmt.Errorf("command execution failed: %w", err)
+		if ctx.Err() == nil && logsMatch(gridAuthPattern, r.LogOutPath, r.LogErrPath) {
+			return newStageError(ErrorClassGridAuth, "GRID authentication failed: %w", err)
+		}
+		return newStageError(ErrorClassMissingFiles, "not all AOD files were downloaded: %w", err)
 	}
 
 	err = os.WriteFile(r.LocalListPath, []byte{}, os.ModePerm)
@@ -108,7 +132,7 @@ func (r *GridDownloadRunner) Run() error {
 		sourcePath := filepath.Join(r.AodsOutputDir, remoteURL)
 		err = os.Rename(sourcePath, localPath)
 		if err != nil {
-			return fmt.Errorf("failed to move file %s to %s: %w", sourcePath, localPath, err)
+			return newStageError(ErrorClassMissingFiles, "failed to move file %s to %s: %w", sourcePath, localPath, err)
 		}
 
 		_, err = localList.WriteString(localPath + "\n")
@@ -119,7 +143,7 @@ func (r *GridDownloadRunner) Run() error {
 
 	pythonVenvBin := filepath.Join(r.VenvDirPath, "bin/python3")
 	pidMlProducerSubscriptPath := filepath.Join(r.DataDirPath, ProducerRunSubscriptName)
-	cmd = exec.Command(pythonVenvBin, r.PIDMLProducerGenerateScript, lastLocalPath, pidMlProducerSubscriptPath)
+	cmd = newCommand(ctx, pythonVenvBin, r.PIDMLProducerGenerateScript, lastLocalPath, pidMlProducerSubscriptPath)
 	cmd.Stdout = multiWriterOut
 	cmd.Stderr = multiWriterErr
 
@@ -139,6 +163,47 @@ func (r *GridDownloadRunner) Run() error {
 	return nil
 }
 
+// gridCredentials writes GRID certificate and key from secrets to private
+// temporary directory and returns environment pointing alien tools to them.
+// Returned function removes the directory. No environment is returned if
+// the secrets are not stored.
+func (r *GridDownloadRunner) gridCredentials() ([]string, func(), error) {
+	noop := func() {}
+
+	cert, err := r.Secrets.Secret(config.SecretGridUserCert)
+	if errors.Is(err, config.ErrSecretNotFound) {
+		return nil, noop, nil
+	}
+	if err != nil {
+		return nil, noop, err
+	}
+	key, err := r.Secrets.Secret(config.SecretGridUserKey)
+	if err != nil {
+		return nil, noop, err
+	}
+
+	dir, err := os.MkdirTemp("", "alicetraint-grid-")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	certPath := filepath.Join(dir, "usercert.pem")
+	keyPath := filepath.Join(dir, "userkey.pem")
+	err = os.WriteFile(certPath, cert, 0600)
+	if err == nil {
+		err = os.WriteFile(keyPath, key, 0400)
+	}
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+
+	return []string{"X509_USER_CERT=" + certPath, "X509_USER_KEY=" + keyPath}, cleanup, nil
+}
+
 func (r *GridDownloadRunner) prepareFileList() error {
 	err := os.MkdirAll(filepath.Dir(r.RemoteListPath), os.ModeDir|os.ModePerm)
 	if err != nil {
@@ -166,8 +231,12 @@ func (r *GridDownloadRunner) prepareFileList() error {
 	return nil
 }
 
-func (r *GridDownloadRunner) UploadLogs(ttId uint) error {
-	err := client.UploadTaskResult(r.Config, ttId, &client.TaskResultPayload{
+func (r *GridDownloadRunner) LogPaths() []string {
+	return []string{r.LogErrPath, r.LogOutPath}
+}
+
+func (r *GridDownloadRunner) UploadLogs(ctx context.Context, ttId uint) error {
+	err := r.Uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 		Name:        filepath.Base(r.LogOutPath),
 		Description: "Stdout log file of GRID downloader script.",
 		Type:        client.Log,
@@ -177,7 +246,7 @@ func (r *GridDownloadRunner) UploadLogs(ttId uint) error {
 		return err
 	}
 
-	err = client.UploadTaskResult(r.Config, ttId, &client.TaskResultPayload{
+	err = r.Uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 		Name:        filepath.Base(r.LogErrPath),
 		Description: "Stderr log file of GRID downloader script.",
 		Type:        client.Log,
@@ -190,6 +259,6 @@ func (r *GridDownloadRunner) UploadLogs(ttId uint) error {
 	return nil
 }
 
-func (r *GridDownloadRunner) UploadResults(ttId uint) error {
+func (r *GridDownloadRunner) UploadResults(ctx context.Context, ttId uint) error {
 	return nil
 }
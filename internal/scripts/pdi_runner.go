@@ -1,10 +1,11 @@
 package scripts
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -21,58 +22,102 @@ const (
 	PdiCommandBenchmark       PdiCommand = "benchmark"
 )
 
+// PdiCommands lists pdi commands supported by the module.
+var PdiCommands = []PdiCommand{PdiCommandTrain, PdiCommandProcess, PdiCommandDataExploration, PdiCommandBenchmark}
+
+func (c PdiCommand) IsValid() bool {
+	switch c {
+	case PdiCommandTrain, PdiCommandProcess, PdiCommandDataExploration, PdiCommandBenchmark:
+		return true
+	}
+
+	return false
+}
+
 type PdiRunner struct {
 	*config.Config
+	progressReporting
+	Uploader   ResultUploader
 	Command    PdiCommand
 	Args       []string
 	LogOutPath string
 	LogErrPath string
 }
 
-func NewPdiRunner(command PdiCommand, cfg *config.Config, args ...string) *PdiRunner {
+func NewPdiRunner(command PdiCommand, cfg *config.Config, uploader ResultUploader, args ...string) *PdiRunner {
+	var parser ProgressParser
+	if command == PdiCommandTrain {
+		parser = EpochsProgressParser()
+	}
+
 	return &PdiRunner{
-		Command:    command,
-		Config:     cfg,
-		Args:       args,
-		LogOutPath: filepath.Join(cfg.ResultsDirPath, fmt.Sprintf("pdi_%s_out.log", string(command))),
-		LogErrPath: filepath.Join(cfg.ResultsDirPath, fmt.Sprintf("pdi_%s_err.log", string(command))),
+		progressReporting: progressReporting{parser: parser},
+		Uploader:          uploader,
+		Command:           command,
+		Config:            cfg,
+		Args:              args,
+		LogOutPath:        filepath.Join(cfg.ResultsDirPath, fmt.Sprintf("pdi_%s_out.log", string(command))),
+		LogErrPath:        filepath.Join(cfg.ResultsDirPath, fmt.Sprintf("pdi_%s_err.log", string(command))),
 	}
 }
 
-func (p *PdiRunner) Run() error {
+func (p *PdiRunner) Run(ctx context.Context) error {
 	os.Setenv("PDI_DIR", p.PdiDirPath)
 	os.Setenv("DATA_DIR", p.DataDirPath)
 	os.Setenv("RESULTS_DIR", p.ResultsDirPath)
 
-	logFileOut, err := os.OpenFile(p.LogOutPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	logFileOut, err := os.OpenFile(p.LogOutPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer logFileOut.Close()
-	multiWriterOut := io.MultiWriter(logFileOut, os.Stdout)
+	multiWriterOut := p.progressWriter(io.MultiWriter(logFileOut, os.Stdout))
 
-	logFileErr, err := os.OpenFile(p.LogErrPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	logFileErr, err := os.OpenFile(p.LogErrPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer logFileErr.Close()
-	multiWriterErr := io.MultiWriter(logFileErr, os.Stderr)
+	multiWriterErr := p.progressWriter(io.MultiWriter(logFileErr, os.Stderr))
 
 	pythonVenvBin := filepath.Join(p.VenvDirPath, "bin/python3")
 	scriptPath := filepath.Join(p.ScriptsDirPath, "pdi_scripts.py")
 
 	cmdArgs := append([]string{scriptPath, string(p.Command)}, p.Args...)
 
-	cmd := exec.Command(pythonVenvBin, cmdArgs...)
+	cmd := newCommand(ctx, pythonVenvBin, cmdArgs...)
 	cmd.Stdout = multiWriterOut
 	cmd.Stderr = multiWriterErr
 
 	fmt.Printf("Executing: %s %s\n", pythonVenvBin, strings.Join(cmdArgs, " "))
-	return cmd.Run()
+	err = cmd.Run()
+	if err != nil && ctx.Err() == nil {
+		return p.classifyError(err)
+	}
+
+	return err
 }
 
-func (p *PdiRunner) UploadLogs(ttId uint) error {
-	err := client.UploadTaskResult(p.Config, ttId, &client.TaskResultPayload{
+// classifyError finds out cause of failed pdi command from its logs.
+func (p *PdiRunner) classifyError(err error) error {
+	switch {
+	case p.Command == PdiCommandTrain && logsMatch(divergencePattern, p.LogErrPath, p.LogOutPath):
+		return newStageError(ErrorClassTrainingDivergence, "training diverged: %w", err)
+	case logsMatch(emptyDatasetPattern, p.LogErrPath, p.LogOutPath):
+		return newStageError(ErrorClassEmptyDataset, "%s got empty dataset: %w", string(p.Command), err)
+	case logsMatch(missingFilePattern, p.LogErrPath):
+		return newStageError(ErrorClassMissingFiles, "%s is missing input files: %w", string(p.Command), err)
+	}
+
+	return err
+}
+
+func (p *PdiRunner) LogPaths() []string {
+	return []string{p.LogErrPath, p.LogOutPath}
+}
+
+func (p *PdiRunner) UploadLogs(ctx context.Context, ttId uint) error {
+	err := p.Uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 		Name:        filepath.Base(p.LogOutPath),
 		Description: fmt.Sprintf("Log file of %s pdi's command", string(p.Command)),
 		Type:        client.Log,
@@ -82,7 +127,7 @@ func (p *PdiRunner) UploadLogs(ttId uint) error {
 		return err
 	}
 
-	err = client.UploadTaskResult(p.Config, ttId, &client.TaskResultPayload{
+	err = p.Uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 		Name:        filepath.Base(p.LogErrPath),
 		Description: fmt.Sprintf("Log file of %s pdi's command", string(p.Command)),
 		Type:        client.Log,
@@ -95,8 +140,12 @@ func (p *PdiRunner) UploadLogs(ttId uint) error {
 	return nil
 }
 
-func uploadWalkDir(cfg *config.Config, rootDir string, resType client.TaskResultType, ttId uint, descFunc func(name string) string) error {
-	return filepath.WalkDir(rootDir, func(path string, d os.DirEntry, err error) error {
+// uploadWalkDir uploads all files of given result type found in rootDir.
+// Files which failed to upload do not stop the walk, their errors are
+// returned together.
+func uploadWalkDir(ctx context.Context, uploader ResultUploader, rootDir string, resType client.TaskResultType, ttId uint, descFunc func(name string) string) error {
+	var uploadErrs []error
+	err := filepath.WalkDir(rootDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			fmt.Println("Error accessing path:", err)
 			return err
@@ -105,24 +154,38 @@ func uploadWalkDir(cfg *config.Config, rootDir string, resType client.TaskResult
 		if !d.IsDir() {
 			if strings.HasSuffix(d.Name(), client.GetExtensionFromResultType(resType)) {
 				fmt.Println("Found file:", path)
-				client.UploadTaskResult(cfg, ttId, &client.TaskResultPayload{
+				err := uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 					Name:        d.Name(),
 					Description: descFunc(d.Name()),
 					Type:        resType,
 					FilePath:    path,
 				})
+				if err != nil {
+					uploadErrs = append(uploadErrs, fmt.Errorf("failed to upload %s: %w", path, err))
+				}
 			}
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	err = errors.Join(uploadErrs...)
+	if err != nil {
+		return &StageError{Class: ErrorClassUpload, Err: err}
+	}
+
+	return nil
 }
 
-func (p *PdiRunner) UploadResults(ttId uint) error {
+func (p *PdiRunner) UploadResults(ctx context.Context, ttId uint) error {
 	switch p.Command {
 	case PdiCommandProcess:
 	case PdiCommandDataExploration:
 		return uploadWalkDir(
-			p.Config,
+			ctx,
+			p.Uploader,
 			filepath.Join(p.ResultsDirPath, "data-exploration"),
 			client.Image,
 			ttId,
@@ -132,7 +195,8 @@ func (p *PdiRunner) UploadResults(ttId uint) error {
 		)
 	case PdiCommandTrain:
 		return uploadWalkDir(
-			p.Config,
+			ctx,
+			p.Uploader,
 			filepath.Join(p.ResultsDirPath, "models"),
 			client.Onnx,
 			ttId,
@@ -143,7 +207,8 @@ func (p *PdiRunner) UploadResults(ttId uint) error {
 		)
 	case PdiCommandBenchmark:
 		err := uploadWalkDir(
-			p.Config,
+			ctx,
+			p.Uploader,
 			filepath.Join(p.ResultsDirPath, "benchmark"),
 			client.Image,
 			ttId,
@@ -155,7 +220,8 @@ func (p *PdiRunner) UploadResults(ttId uint) error {
 			return err
 		}
 		return uploadWalkDir(
-			p.Config,
+			ctx,
+			p.Uploader,
 			filepath.Join(p.ResultsDirPath, "feature_importance"),
 			client.Image,
 			ttId,
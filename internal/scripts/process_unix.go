@@ -0,0 +1,21 @@
+//go:build unix
+
+package scripts
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		time.AfterFunc(killGracePeriod, func() {
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		})
+
+		return syscall.Kill(-pgid, syscall.SIGTERM)
+	}
+}
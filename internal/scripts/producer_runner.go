@@ -1,10 +1,10 @@
 package scripts
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
@@ -12,40 +12,44 @@ import (
 )
 
 const (
-	PreprocessedAodFileName = "preprocessed_ao2ds"
-	ProducerRunScriptName   = "run-pidml-producer.sh"
-	ProducerRunSubscriptName  = "run-pidml-producer.sh"
-	ProducerConfigFileName  = "ml-mc-config.json"
+	PreprocessedAodFileName  = "preprocessed_ao2ds"
+	ProducerRunScriptName    = "run-pidml-producer.sh"
+	ProducerRunSubscriptName = "run-pidml-producer.sh"
+	ProducerConfigFileName   = "ml-mc-config.json"
 )
 
 type ProducerRunner struct {
 	*config.Config
+	progressReporting
+	Uploader      ResultUploader
 	LocalListPath string
 	LogErrPath    string
 	LogOutPath    string
 }
 
-func NewProducerRunner(cfg *config.Config) *ProducerRunner {
+func NewProducerRunner(cfg *config.Config, uploader ResultUploader) *ProducerRunner {
 	return &ProducerRunner{
-		Config:        cfg,
-		LocalListPath: filepath.Join(cfg.DataDirPath, LocalListName),
-		LogErrPath:    filepath.Join(cfg.ResultsDirPath, "pidml_producer_err.log"),
-		LogOutPath:    filepath.Join(cfg.ResultsDirPath, "pidml_producer_out.log"),
+		Config:            cfg,
+		progressReporting: progressReporting{parser: &InputFilesParser{}},
+		Uploader:          uploader,
+		LocalListPath:     filepath.Join(cfg.DataDirPath, LocalListName),
+		LogErrPath:        filepath.Join(cfg.ResultsDirPath, "pidml_producer_err.log"),
+		LogOutPath:        filepath.Join(cfg.ResultsDirPath, "pidml_producer_out.log"),
 	}
 }
 
-func (p *ProducerRunner) Run() error {
+func (p *ProducerRunner) Run(ctx context.Context) error {
 	localListPath := filepath.Join(p.DataDirPath, "local_list.txt")
 	pidMlProducerScriptPath := filepath.Join(p.ScriptsDirPath, ProducerRunScriptName)
 	pidMlProducerSubscriptPath := filepath.Join(p.DataDirPath, ProducerRunSubscriptName)
 	pidMlProducerConfigPath := filepath.Join(p.ScriptsDirPath, ProducerConfigFileName)
 
-	logErr, err := os.OpenFile(p.LogErrPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	logErr, err := os.OpenFile(p.LogErrPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer logErr.Close()
-	logOut, err := os.OpenFile(p.LogOutPath, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	logOut, err := os.OpenFile(p.LogOutPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
@@ -61,21 +65,38 @@ func (p *ProducerRunner) Run() error {
 		preprocessedRootName,
 		pidMlProducerSubscriptPath,
 	)
-	pidMlProducerCmd := exec.Command("bash", "-c", alienvCommand)
-	pidMlProducerCmd.Stdout = logOut
-	pidMlProducerCmd.Stderr = logErr
+	pidMlProducerCmd := newCommand(ctx, "bash", "-c", alienvCommand)
+	if parser, ok := p.parser.(inputListParser); ok {
+		err = parser.loadInputList(localListPath)
+		if err != nil {
+			return fmt.Errorf("failed to read input list for progress parser: %w", err)
+		}
+	}
+
+	pidMlProducerCmd.Stdout = p.progressWriter(logOut)
+	pidMlProducerCmd.Stderr = p.progressWriter(logErr)
 
 	log.Printf("Running PID ML producer task, logs in err: %s, out: %s", p.LogErrPath, p.LogOutPath)
 	err = pidMlProducerCmd.Run()
 	if err != nil {
-		return fmt.Errorf("command execution failed: %w", err)
+		return newStageError(ErrorClassProducerCrash, "PID ML producer failed: %w", err)
+	}
+
+	preprocessedRootPath := filepath.Join(p.DataDirPath, fmt.Sprintf("%s.root", PreprocessedAodFileName))
+	info, err := os.Stat(preprocessedRootPath)
+	if err != nil || info.Size() == 0 {
+		return newStageError(ErrorClassEmptyDataset, "PID ML producer produced no data in %s", preprocessedRootPath)
 	}
 
 	return nil
 }
 
-func (p *ProducerRunner) UploadLogs(ttId uint) error {
-	err := client.UploadTaskResult(p.Config, ttId, &client.TaskResultPayload{
+func (p *ProducerRunner) LogPaths() []string {
+	return []string{p.LogErrPath, p.LogOutPath}
+}
+
+func (p *ProducerRunner) UploadLogs(ctx context.Context, ttId uint) error {
+	err := p.Uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 		Name:        filepath.Base(p.LogOutPath),
 		Description: "Stdout log file of PID ML Producer run.",
 		Type:        client.Log,
@@ -85,7 +106,7 @@ func (p *ProducerRunner) UploadLogs(ttId uint) error {
 		return err
 	}
 
-	err = client.UploadTaskResult(p.Config, ttId, &client.TaskResultPayload{
+	err = p.Uploader.UploadTaskResult(ctx, ttId, &client.TaskResultPayload{
 		Name:        filepath.Base(p.LogErrPath),
 		Description: "Stderr log file of PID ML Producer run.",
 		Type:        client.Log,
@@ -98,6 +119,6 @@ func (p *ProducerRunner) UploadLogs(ttId uint) error {
 	return nil
 }
 
-func (p *ProducerRunner) UploadResults(ttId uint) error {
+func (p *ProducerRunner) UploadResults(ctx context.Context, ttId uint) error {
 	return nil
 }
@@ -0,0 +1,241 @@
+package scripts
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress of running command parsed from its output. ETA is zero when it
+// cannot be estimated yet.
+type Progress struct {
+	Percent float64
+	ETA     time.Duration
+	Message string
+}
+
+type ProgressFunc func(progress Progress)
+
+// ProgressParser extracts progress from a single line of command output.
+type ProgressParser interface {
+	ParseLine(line string) (Progress, bool)
+}
+
+// ProgressReporter is implemented by commands which can report progress
+// parsed from output of their processes.
+type ProgressReporter interface {
+	SetProgressParser(parser ProgressParser)
+	SetProgressFunc(fn ProgressFunc)
+}
+
+const (
+	ProgressParserNone         = "none"
+	ProgressParserGridDownload = "grid-download"
+	ProgressParserEpochs       = "epochs"
+	ProgressParserDpl          = "dpl"
+	progressParserRegexPrefix  = "regex:"
+)
+
+// NewProgressParser returns parser of given name. Besides built-in parsers,
+// "regex:<pattern>" creates RatioParser for pattern with two submatches: done
+// and total count.
+func NewProgressParser(name string) (ProgressParser, error) {
+	switch name {
+	case ProgressParserNone:
+		return nil, nil
+	case ProgressParserGridDownload:
+		return GridDownloadProgressParser(), nil
+	case ProgressParserEpochs:
+		return EpochsProgressParser(), nil
+	case ProgressParserDpl:
+		return &InputFilesParser{}, nil
+	}
+
+	if pattern, ok := strings.CutPrefix(name, progressParserRegexPrefix); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid progress pattern: %w", err)
+		}
+		if re.NumSubexp() < 2 {
+			return nil, fmt.Errorf("progress pattern %q must have two submatches: done and total", pattern)
+		}
+		return &RatioParser{Pattern: re, Unit: "steps"}, nil
+	}
+
+	return nil, fmt.Errorf("unknown progress parser %q", name)
+}
+
+// RatioParser reports progress from lines matching Pattern, whose first two
+// submatches are done and total count of Unit.
+type RatioParser struct {
+	Pattern *regexp.Regexp
+	Unit    string
+}
+
+// GridDownloadProgressParser parses "Done: x/y" lines of download-from-grid.sh.
+func GridDownloadProgressParser() *RatioParser {
+	return &RatioParser{Pattern: regexp.MustCompile(`Done: (\d+)/(\d+)`), Unit: "files downloaded"}
+}
+
+// EpochsProgressParser parses "Epoch x/y" (or "epoch x of y") lines of training.
+func EpochsProgressParser() *RatioParser {
+	return &RatioParser{Pattern: regexp.MustCompile(`(?i)epoch\W*(\d+)\s*(?:/|of)\s*(\d+)`), Unit: "epochs"}
+}
+
+func (p *RatioParser) ParseLine(line string) (Progress, bool) {
+	match := p.Pattern.FindStringSubmatch(line)
+	if match == nil {
+		return Progress{}, false
+	}
+
+	done, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return Progress{}, false
+	}
+	total, err := strconv.ParseFloat(match[2], 64)
+	if err != nil || total <= 0 {
+		return Progress{}, false
+	}
+
+	return Progress{
+		Percent: min(100, 100*done/total),
+		Message: fmt.Sprintf("%s/%s %s", match[1], match[2], p.Unit),
+	}, true
+}
+
+// InputFilesParser reports progress of DPL workflow as fraction of its input
+// files which were already mentioned in the workflow output (e.g. opened by
+// AOD reader).
+type InputFilesParser struct {
+	files []string
+	seen  map[string]bool
+}
+
+// inputListParser is implemented by parsers which need list of command input
+// files.
+type inputListParser interface {
+	loadInputList(listPath string) error
+}
+
+func (p *InputFilesParser) loadInputList(listPath string) error {
+	file, err := os.Open(listPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p.files = nil
+	p.seen = make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			p.files = append(p.files, filepath.Base(line))
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (p *InputFilesParser) ParseLine(line string) (Progress, bool) {
+	for _, name := range p.files {
+		if !p.seen[name] && strings.Contains(line, name) {
+			p.seen[name] = true
+			return Progress{
+				Percent: 100 * float64(len(p.seen)) / float64(len(p.files)),
+				Message: fmt.Sprintf("%d/%d input files read", len(p.seen), len(p.files)),
+			}, true
+		}
+	}
+
+	return Progress{}, false
+}
+
+// progressReporting implements ProgressReporter for runners. It estimates
+// ETA from the rate of progress since the first report.
+type progressReporting struct {
+	parser     ProgressParser
+	onProgress ProgressFunc
+
+	mu           sync.Mutex
+	firstTime    time.Time
+	firstPercent float64
+}
+
+func (r *progressReporting) SetProgressParser(parser ProgressParser) {
+	r.parser = parser
+}
+
+func (r *progressReporting) SetProgressFunc(fn ProgressFunc) {
+	r.onProgress = fn
+}
+
+// progressWriter returns w extended with parsing progress from the written
+// output, if the runner reports progress.
+func (r *progressReporting) progressWriter(w io.Writer) io.Writer {
+	if r.parser == nil || r.onProgress == nil {
+		return w
+	}
+
+	return io.MultiWriter(w, &lineWriter{onLine: r.parseLine})
+}
+
+func (r *progressReporting) parseLine(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	progress, ok := r.parser.ParseLine(line)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if r.firstTime.IsZero() {
+		r.firstTime = now
+		r.firstPercent = progress.Percent
+	} else if progress.Percent > r.firstPercent {
+		elapsed := now.Sub(r.firstTime)
+		rate := (progress.Percent - r.firstPercent) / elapsed.Seconds()
+		progress.ETA = time.Duration((100 - progress.Percent) / rate * float64(time.Second)).Round(time.Second)
+	}
+
+	r.onProgress(progress)
+}
+
+// maxLineLength bounds buffered output of lineWriter, longer lines are
+// dropped.
+const maxLineLength = 64 * 1024
+
+// lineWriter splits written output into lines and passes them to onLine.
+// Carriage return is treated as line end too, since progress bars use it to
+// overwrite the current line.
+type lineWriter struct {
+	onLine func(line string)
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			w.onLine(string(w.buf[:i]))
+		}
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxLineLength {
+		w.buf = w.buf[:0]
+	}
+
+	return len(p), nil
+}
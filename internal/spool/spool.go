@@ -0,0 +1,506 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/backoff"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+)
+
+const (
+	entryFilePrefix = "entry-"
+	entryFileSuffix = ".json"
+)
+
+type EntryKind string
+
+const (
+	EntryUpload EntryKind = "upload"
+	EntryStatus EntryKind = "status"
+)
+
+// Entry is a single journaled request to the web interface. Artifact of
+// upload is kept in the spool directory, so it survives wiping of the
+// workspace.
+type Entry struct {
+	Seq    uint64
+	TaskID uint
+	Kind   EntryKind
+	Result *client.TaskResultPayload       `json:",omitempty"`
+	Status *client.UpdateTaskStatusPayload `json:",omitempty"`
+}
+
+// Spool is on-disk outbox of task results and status updates. Requests are
+// journaled first and delivered in order by Run, retrying them until the web
+// interface accepts or rejects them, also across restarts of the module.
+type Spool struct {
+	dir        string
+	client     *client.Client
+	maxBackoff time.Duration
+
+	// delivering serializes delivery of entries by Run and Drain
+	delivering sync.Mutex
+
+	mu      sync.Mutex
+	entries []*Entry
+	nextSeq uint64
+	notify  chan struct{}
+	// inflight is entry being delivered, its files are removed only after
+	// the delivery, even if it is discarded meanwhile
+	inflight *Entry
+	// rejected holds failures of tasks whose results were rejected by web
+	// interface, they replace Completed status of the task
+	rejected map[uint]*client.FailureReport
+}
+
+// New opens spool in dir, entries left by previous run of the module are
+// loaded to be delivered.
+func New(dir string, c *client.Client, maxBackoff time.Duration) (*Spool, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{
+		dir:        dir,
+		client:     c,
+		maxBackoff: maxBackoff,
+		nextSeq:    1,
+		notify:     make(chan struct{}, 1),
+		rejected:   make(map[uint]*client.FailureReport),
+	}
+
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(s.entries) > 0 {
+		log.Printf("Spool has %d undelivered requests from previous run", len(s.entries))
+	}
+
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, entryFilePrefix) || !strings.HasSuffix(name, entryFileSuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read spool entry: %w", err)
+		}
+
+		var entry Entry
+		err = json.Unmarshal(data, &entry)
+		if err != nil {
+			log.Printf("Dropping corrupted spool entry %s: %s", name, err.Error())
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+
+		s.entries = append(s.entries, &entry)
+		if entry.Seq >= s.nextSeq {
+			s.nextSeq = entry.Seq + 1
+		}
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].Seq < s.entries[j].Seq })
+
+	return s.removeOrphans(files)
+}
+
+// removeOrphans removes artifacts and temporary files left by the module
+// killed while journaling a request.
+func (s *Spool) removeOrphans(files []os.DirEntry) error {
+	referenced := make(map[string]bool)
+	for _, entry := range s.entries {
+		if entry.Result != nil {
+			referenced[entry.Result.FilePath] = true
+		}
+	}
+
+	for _, file := range files {
+		path := filepath.Join(s.dir, file.Name())
+		if file.IsDir() || referenced[path] || strings.HasPrefix(file.Name(), entryFilePrefix) && strings.HasSuffix(file.Name(), entryFileSuffix) {
+			continue
+		}
+
+		err := os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove orphaned spool file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Spool) entryPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", entryFilePrefix, seq, entryFileSuffix))
+}
+
+// UploadTaskResult journals upload of task result. The file is copied into
+// the spool, so it may be removed once this returns.
+func (s *Spool) UploadTaskResult(ctx context.Context, ttId uint, ttr *client.TaskResultPayload) error {
+	s.mu.Lock()
+	seq := s.nextSeq
+	s.nextSeq++
+	s.mu.Unlock()
+
+	artifactPath := filepath.Join(s.dir, fmt.Sprintf("artifact-%020d-%s", seq, filepath.Base(ttr.FilePath)))
+	err := copyFile(ttr.FilePath, artifactPath)
+	if err != nil {
+		return fmt.Errorf("failed to spool %s: %w", ttr.FilePath, err)
+	}
+
+	result := *ttr
+	result.FilePath = artifactPath
+	result.Progress = nil
+
+	err = s.enqueue(&Entry{Seq: seq, TaskID: ttId, Kind: EntryUpload, Result: &result})
+	if err != nil {
+		os.Remove(artifactPath)
+	}
+
+	return err
+}
+
+// UpdateTaskStatusWithPayload journals status update of training task.
+// Completed status of task whose result was rejected by web interface is
+// journaled as Failed with upload failure class.
+func (s *Spool) UpdateTaskStatusWithPayload(ctx context.Context, ttId uint, payload *client.UpdateTaskStatusPayload) error {
+	s.mu.Lock()
+	seq := s.nextSeq
+	s.nextSeq++
+	if failure, ok := s.rejected[ttId]; ok && payload.Status == client.Completed {
+		log.Printf("Training Task of id %d, its result was rejected, reporting status Failed instead of Completed", ttId)
+		payload = &client.UpdateTaskStatusPayload{Status: client.Failed, Failure: failure}
+		delete(s.rejected, ttId)
+	}
+	s.mu.Unlock()
+
+	return s.enqueue(&Entry{Seq: seq, TaskID: ttId, Kind: EntryStatus, Status: payload})
+}
+
+func (s *Spool) enqueue(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spool entry: %w", err)
+	}
+
+	err = writeFileSync(s.entryPath(entry.Seq), data)
+	if err != nil {
+		return fmt.Errorf("failed to write spool entry: %w", err)
+	}
+
+	s.mu.Lock()
+	s.entries = append(s.entries, entry)
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].Seq < s.entries[j].Seq })
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Idle reports whether all journaled requests were delivered.
+func (s *Spool) Idle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries) == 0
+}
+
+// Pending reports whether there are undelivered requests of training task.
+func (s *Spool) Pending(ttId uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.TaskID == ttId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Discard drops undelivered requests of training task of given kinds, all
+// of them if no kind is given.
+func (s *Spool) Discard(ttId uint, kinds ...EntryKind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.entries[:0]
+	for _, entry := range s.entries {
+		if entry.TaskID == ttId && (len(kinds) == 0 || hasKind(kinds, entry.Kind)) {
+			if entry != s.inflight {
+				s.removeFiles(entry)
+			}
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	s.entries = kept
+	if len(kinds) == 0 {
+		delete(s.rejected, ttId)
+	}
+}
+
+func hasKind(kinds []EntryKind, kind EntryKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// takeFirst marks the first entry as being delivered and returns it.
+func (s *Spool) takeFirst() *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) == 0 {
+		return nil
+	}
+	s.inflight = s.entries[0]
+
+	return s.inflight
+}
+
+// release ends delivery of entry, removing it if it was delivered or
+// rejected. Files of entry discarded during the delivery are removed too.
+func (s *Spool) release(entry *Entry, delivered bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight = nil
+	for i, e := range s.entries {
+		if e == entry {
+			if delivered {
+				s.entries = append(s.entries[:i], s.entries[i+1:]...)
+				s.removeFiles(entry)
+			}
+			return
+		}
+	}
+	s.removeFiles(entry)
+}
+
+func (s *Spool) removeFiles(entry *Entry) {
+	err := os.Remove(s.entryPath(entry.Seq))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove spool entry %d: %s", entry.Seq, err.Error())
+	}
+
+	if entry.Result != nil {
+		err = os.Remove(entry.Result.FilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove spooled artifact %s: %s", entry.Result.FilePath, err.Error())
+		}
+	}
+}
+
+// Run delivers journaled requests in order until ctx is done. Request failed
+// because of outage of web interface is retried with exponential backoff,
+// request rejected by web interface is dropped.
+func (s *Spool) Run(ctx context.Context) {
+	bo := backoff.New(time.Second, s.maxBackoff)
+	for {
+		entry, err := s.deliverFirst(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if entry == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.notify:
+			}
+			continue
+		}
+
+		if err != nil {
+			wait := bo.Next()
+			log.Printf("Training Task of id %d, failed to deliver spooled %s, retrying in %s. Error text: %s", entry.TaskID, entry.Kind, wait.Round(time.Millisecond), err.Error())
+			if backoff.Sleep(ctx, wait) != nil {
+				return
+			}
+			continue
+		}
+		bo.Reset()
+	}
+}
+
+// Drain delivers journaled requests until the spool is empty or ctx is done.
+// It is called on shutdown after Run returned, so requests journaled last
+// (e.g. partial logs of interrupted task) are not left until restart.
+func (s *Spool) Drain(ctx context.Context) error {
+	bo := backoff.New(time.Second, s.maxBackoff)
+	for {
+		entry, err := s.deliverFirst(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry == nil {
+			return nil
+		}
+
+		if err != nil {
+			err = backoff.Sleep(ctx, bo.Next())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		bo.Reset()
+	}
+}
+
+// deliverFirst delivers the first journaled request and returns it, nil if
+// the spool is empty. Error is returned only if delivery of the request
+// failed because of outage of web interface and it should be retried.
+func (s *Spool) deliverFirst(ctx context.Context) (*Entry, error) {
+	s.delivering.Lock()
+	defer s.delivering.Unlock()
+
+	entry := s.takeFirst()
+	if entry == nil {
+		return nil, nil
+	}
+
+	err := s.deliver(ctx, entry)
+	if ctx.Err() != nil || err != nil && (client.IsTransient(err) || errors.Is(err, client.ErrUnauthorized)) {
+		s.release(entry, false)
+		return entry, err
+	}
+
+	if err != nil {
+		log.Printf("Training Task of id %d, spooled %s rejected, dropping it. Error text: %s", entry.TaskID, entry.Kind, err.Error())
+		if entry.Kind == EntryUpload && entry.Result.Type != client.Log {
+			s.rejectResult(entry, err)
+		}
+	}
+	s.release(entry, true)
+
+	return entry, nil
+}
+
+// rejectResult records failure of task whose result was rejected by web
+// interface, so the task is not reported as completed without it. Completed
+// status already journaled is replaced, later one is replaced when journaled.
+func (s *Spool) rejectResult(entry *Entry, err error) {
+	failure := &client.FailureReport{
+		Class:   string(scripts.ErrorClassUpload),
+		Message: fmt.Sprintf("result %s rejected by web interface: %s", entry.Result.Name, err.Error()),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.TaskID != entry.TaskID || e.Kind != EntryStatus || e.Status.Status != client.Completed {
+			continue
+		}
+
+		log.Printf("Training Task of id %d, its result was rejected, reporting status Failed instead of Completed", e.TaskID)
+		e.Status = &client.UpdateTaskStatusPayload{Status: client.Failed, Failure: failure}
+		data, err := json.Marshal(e)
+		if err == nil {
+			err = writeFileSync(s.entryPath(e.Seq), data)
+		}
+		if err != nil {
+			log.Printf("Failed to rewrite spool entry %d: %s", e.Seq, err.Error())
+		}
+		return
+	}
+	if _, ok := s.rejected[entry.TaskID]; !ok {
+		s.rejected[entry.TaskID] = failure
+	}
+}
+
+func (s *Spool) deliver(ctx context.Context, entry *Entry) error {
+	switch entry.Kind {
+	case EntryUpload:
+		return s.client.UploadTaskResult(ctx, entry.TaskID, entry.Result)
+	case EntryStatus:
+		return s.client.UpdateTaskStatusWithPayload(ctx, entry.TaskID, entry.Status)
+	}
+
+	return fmt.Errorf("unknown spool entry kind %s", entry.Kind)
+}
+
+// copyFile copies src to dst. Files are not hard linked, spooled artifact
+// would change with workspace file rewritten in place when its stage is run
+// again.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+
+	return err
+}
+
+// writeFileSync atomically writes file, so the entry is never left
+// half-written if the module is killed.
+func writeFileSync(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,334 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/scripts"
+)
+
+// delivered is request received by web interface of spool test, Name is
+// name of uploaded result or status of status update.
+type delivered struct {
+	TaskID  uint
+	Name    string
+	Content string
+	Failure *client.FailureReport
+}
+
+// webInterface records requests delivered by the spool. Uploads are
+// answered with uploadStatus, status updates are always accepted.
+type webInterface struct {
+	uploadStatus int
+	// uploading, if set, receives name of every upload before it is
+	// answered, which waits until release is closed
+	uploading chan string
+	release   chan struct{}
+
+	mu        sync.Mutex
+	delivered []delivered
+}
+
+func (w *webInterface) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	var ttId uint
+	var kind string
+	fmt.Sscanf(r.URL.Path, "/training-tasks/%d/%s", &ttId, &kind)
+
+	request := delivered{TaskID: ttId}
+	status := http.StatusOK
+	switch kind {
+	case "status":
+		var payload client.UpdateTaskStatusPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		request.Name = payload.Status.String()
+		request.Failure = payload.Failure
+	case "training-task-results":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		request.Name = r.FormValue("name")
+		request.Content = string(content)
+		if w.uploading != nil {
+			w.uploading <- request.Name
+			<-w.release
+		}
+		status = w.uploadStatus
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+
+	w.mu.Lock()
+	w.delivered = append(w.delivered, request)
+	w.mu.Unlock()
+	rw.WriteHeader(status)
+}
+
+func (w *webInterface) requests() []delivered {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]delivered(nil), w.delivered...)
+}
+
+// newSpoolTest opens spool in temporary directory delivering requests to
+// web interface w.
+func newSpoolTest(t *testing.T, w *webInterface) (*Spool, *client.Client) {
+	t.Helper()
+	server := httptest.NewServer(w)
+	t.Cleanup(server.Close)
+
+	c := client.New(server.URL, 1, "secret", client.WithRetries(0, time.Millisecond, time.Millisecond))
+	s, err := New(t.TempDir(), c, time.Millisecond)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	return s, c
+}
+
+// writeResult writes file of task result to temporary directory.
+func writeResult(t *testing.T, name, content string) *client.TaskResultPayload {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &client.TaskResultPayload{Name: name, Type: client.Image, FilePath: path}
+}
+
+func spoolFiles(t *testing.T, s *Spool) []string {
+	t.Helper()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestDeliveryOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		reopen bool
+	}{
+		{"same run", false},
+		{"after restart", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := &webInterface{uploadStatus: http.StatusCreated}
+			s, c := newSpoolTest(t, w)
+			ctx := context.Background()
+
+			steps := []error{
+				s.UpdateTaskStatusWithPayload(ctx, 1, &client.UpdateTaskStatusPayload{Status: client.Training}),
+				s.UploadTaskResult(ctx, 1, writeResult(t, "model.onnx", "model")),
+				s.UpdateTaskStatusWithPayload(ctx, 2, &client.UpdateTaskStatusPayload{Status: client.Queued}),
+				s.UpdateTaskStatusWithPayload(ctx, 1, &client.UpdateTaskStatusPayload{Status: client.Completed}),
+			}
+			for i, err := range steps {
+				if err != nil {
+					t.Fatalf("journaling request %d: %v", i, err)
+				}
+			}
+
+			if test.reopen {
+				var err error
+				s, err = New(s.dir, c, time.Millisecond)
+				if err != nil {
+					t.Fatalf("New: %v", err)
+				}
+			}
+			if s.Idle() || !s.Pending(2) || s.Pending(3) {
+				t.Errorf("Idle = %v, Pending(2) = %v, Pending(3) = %v before delivery", s.Idle(), s.Pending(2), s.Pending(3))
+			}
+
+			err := s.Drain(ctx)
+			if err != nil {
+				t.Fatalf("Drain: %v", err)
+			}
+
+			want := []delivered{
+				{TaskID: 1, Name: "Training"},
+				{TaskID: 1, Name: "model.onnx", Content: "model"},
+				{TaskID: 2, Name: "Queued"},
+				{TaskID: 1, Name: "Completed"},
+			}
+			if got := w.requests(); !reflect.DeepEqual(got, want) {
+				t.Errorf("delivered %+v, want %+v", got, want)
+			}
+			if !s.Idle() {
+				t.Error("spool is not idle after Drain")
+			}
+			if files := spoolFiles(t, s); len(files) != 0 {
+				t.Errorf("spool directory has files %v after Drain", files)
+			}
+		})
+	}
+}
+
+func TestSpooledArtifactIsCopy(t *testing.T) {
+	w := &webInterface{uploadStatus: http.StatusCreated}
+	s, _ := newSpoolTest(t, w)
+	ctx := context.Background()
+
+	result := writeResult(t, "pdi_train_out.log", "first run")
+	err := s.UploadTaskResult(ctx, 1, result)
+	if err != nil {
+		t.Fatalf("UploadTaskResult: %v", err)
+	}
+
+	file, err := os.OpenFile(result.FilePath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(file, "second run")
+	file.Close()
+
+	err = s.Drain(ctx)
+	if err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if got := w.requests(); len(got) != 1 || got[0].Content != "first run" {
+		t.Errorf("delivered %+v, want content of the file when it was journaled", got)
+	}
+}
+
+func TestDiscardDuringDelivery(t *testing.T) {
+	w := &webInterface{
+		uploadStatus: http.StatusCreated,
+		uploading:    make(chan string),
+		release:      make(chan struct{}),
+	}
+	s, _ := newSpoolTest(t, w)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := s.UploadTaskResult(ctx, 1, writeResult(t, "model.onnx", "model"))
+	if err != nil {
+		t.Fatalf("UploadTaskResult: %v", err)
+	}
+	err = s.UpdateTaskStatusWithPayload(ctx, 1, &client.UpdateTaskStatusPayload{Status: client.Completed})
+	if err != nil {
+		t.Fatalf("UpdateTaskStatusWithPayload: %v", err)
+	}
+
+	artifacts, err := filepath.Glob(filepath.Join(s.dir, "artifact-*"))
+	if err != nil || len(artifacts) != 1 {
+		t.Fatalf("spooled artifacts %v, %v, want one", artifacts, err)
+	}
+
+	go s.Run(ctx)
+	select {
+	case <-w.uploading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload was not delivered")
+	}
+
+	s.Discard(1)
+	if !s.Idle() {
+		t.Error("spool is not idle after Discard")
+	}
+	if _, err := os.Stat(artifacts[0]); err != nil {
+		t.Errorf("artifact of entry being delivered was removed on Discard: %v", err)
+	}
+
+	close(w.release)
+	err = s.Drain(ctx)
+	if err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if files := spoolFiles(t, s); len(files) != 0 {
+		t.Errorf("spool directory has files %v after delivery of discarded entry", files)
+	}
+	if got := w.requests(); len(got) != 1 {
+		t.Errorf("delivered %+v, want only the upload in flight", got)
+	}
+}
+
+func TestRejectedResult(t *testing.T) {
+	tests := []struct {
+		name string
+		// completedFirst journals Completed status before the rejected
+		// result is delivered, otherwise it is journaled after
+		completedFirst bool
+		resultType     client.TaskResultType
+		want           string
+	}{
+		{"completed journaled before rejection", true, client.Image, "Failed"},
+		{"completed journaled after rejection", false, client.Image, "Failed"},
+		{"rejected log before completed", true, client.Log, "Completed"},
+		{"rejected log after completed", false, client.Log, "Completed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := &webInterface{uploadStatus: http.StatusUnprocessableEntity}
+			s, _ := newSpoolTest(t, w)
+			ctx := context.Background()
+
+			result := writeResult(t, "result", "content")
+			result.Type = test.resultType
+			err := s.UploadTaskResult(ctx, 1, result)
+			if err != nil {
+				t.Fatalf("UploadTaskResult: %v", err)
+			}
+
+			completed := &client.UpdateTaskStatusPayload{Status: client.Completed}
+			if test.completedFirst {
+				err = s.UpdateTaskStatusWithPayload(ctx, 1, completed)
+				if err != nil {
+					t.Fatalf("UpdateTaskStatusWithPayload: %v", err)
+				}
+			}
+			err = s.Drain(ctx)
+			if err != nil {
+				t.Fatalf("Drain: %v", err)
+			}
+			if !test.completedFirst {
+				err = s.UpdateTaskStatusWithPayload(ctx, 1, completed)
+				if err != nil {
+					t.Fatalf("UpdateTaskStatusWithPayload: %v", err)
+				}
+				err = s.Drain(ctx)
+				if err != nil {
+					t.Fatalf("Drain: %v", err)
+				}
+			}
+
+			got := w.requests()
+			if len(got) != 2 {
+				t.Fatalf("delivered %+v, want the result and status", got)
+			}
+			if got[1].Name != test.want {
+				t.Errorf("reported status %s, want %s", got[1].Name, test.want)
+			}
+			if test.want == "Failed" && (got[1].Failure == nil || got[1].Failure.Class != string(scripts.ErrorClassUpload)) {
+				t.Errorf("reported failure %+v, want class %s", got[1].Failure, scripts.ErrorClassUpload)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package tasksource
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+)
+
+type member struct {
+	name     string
+	priority int
+	source   TaskSource
+}
+
+// Prioritized requests queued task from task sources of several web
+// interfaces, in order of their priority. Sources are added once their web
+// interface is ready, until then it is skipped.
+type Prioritized struct {
+	mu      sync.Mutex
+	members []member
+	added   chan struct{}
+}
+
+func NewPrioritized() *Prioritized {
+	return &Prioritized{
+		added: make(chan struct{}),
+	}
+}
+
+// Add adds task source of named web interface. Sources of higher priority are asked first, sources of the same
+// priority in order they were added.
+func (p *Prioritized) Add(name string, priority int, s TaskSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.members = append(p.members, member{name: name, priority: priority, source: s})
+	sort.SliceStable(p.members, func(i, j int) bool { return p.members[i].priority > p.members[j].priority })
+
+	close(p.added)
+	p.added = make(chan struct{})
+}
+
+// Remove removes task source of named web interface.
+func (p *Prioritized) Remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.members = slices.DeleteFunc(p.members, func(m member) bool { return m.name == name })
+}
+
+func (p *Prioritized) snapshot() ([]member, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]member(nil), p.members...), p.added
+}
+
+// Next blocks until a task is queued for the machine on any web interface
+// and returns it with name of the web interface which issued it. Web
+// interfaces are asked in order of priority. Errors of a web interface are
+// logged and it is skipped, only ErrUnauthorized is returned.
+func (p *Prioritized) Next(ctx context.Context) (*client.TrainingTaskResponse, string, error) {
+	for {
+		members, added := p.snapshot()
+		for _, m := range members {
+			tt, err := m.source.poll(ctx)
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			if errors.Is(err, client.ErrUnauthorized) {
+				return nil, m.name, err
+			}
+			if err != nil {
+				log.Printf("Failed to get queued training task from %s. Error text: %s", m.name, err.Error())
+				continue
+			}
+			if tt != nil {
+				return tt, m.name, nil
+			}
+		}
+
+		err := p.wait(ctx, members, added)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// wait waits until any of members should be asked again, announces a task or
+// new member is added.
+func (p *Prioritized) wait(ctx context.Context, members []member, added <-chan struct{}) error {
+	wait := resyncInterval
+	for _, m := range members {
+		wait = min(wait, m.source.waitInterval())
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	woken := make(chan struct{}, 1)
+	for _, m := range members {
+		wakeup := m.source.wakeup()
+		if wakeup == nil {
+			continue
+		}
+		go func() {
+			select {
+			case <-wakeup:
+				select {
+				case woken <- struct{}{}:
+				default:
+				}
+			case <-waitCtx.Done():
+			}
+		}()
+	}
+
+	select {
+	case <-waitCtx.Done():
+		return ctx.Err()
+	case <-woken:
+	case <-added:
+	}
+
+	return nil
+}
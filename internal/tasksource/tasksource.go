@@ -0,0 +1,213 @@
+package tasksource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/backoff"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/config"
+)
+
+const (
+	SourcePolling = "polling"
+	SourceEvents  = "events"
+)
+
+// resyncInterval is how often queued task is requested even when events
+// stream is connected, in case an event was lost.
+const resyncInterval = 5 * time.Minute
+
+// TaskSource provides training tasks queued for the machine through
+// Prioritized, it can be implemented only by this package. It can be asked
+// for queued task once and tells when it should be asked again, so
+// Prioritized can wait for several sources at once.
+type TaskSource interface {
+	// SetPollInterval changes interval of polling for queued tasks.
+	SetPollInterval(interval time.Duration)
+
+	poll(ctx context.Context) (*client.TrainingTaskResponse, error)
+	waitInterval() time.Duration
+	// wakeup returns channel receiving when task is announced, nil if the
+	// source does not announce tasks.
+	wakeup() <-chan struct{}
+}
+
+// New creates task source selected in configuration. Events source listens
+// for events until ctx is done.
+func New(ctx context.Context, cfg *config.Config, c *client.Client) (TaskSource, error) {
+	interval := time.Duration(cfg.PoolingWaitSeconds) * time.Second
+
+	switch cfg.TaskSource {
+	case SourcePolling:
+		return NewPolling(c, interval), nil
+	case SourceEvents:
+		return NewEvents(ctx, c, interval, time.Duration(cfg.MaxBackoffSeconds)*time.Second), nil
+	}
+
+	return nil, fmt.Errorf("unknown task source %q, expected %s or %s", cfg.TaskSource, SourcePolling, SourceEvents)
+}
+
+// Polling requests queued task from web interface in fixed intervals.
+type Polling struct {
+	client   *client.Client
+	interval atomic.Int64
+}
+
+func NewPolling(c *client.Client, interval time.Duration) *Polling {
+	p := &Polling{
+		client: c,
+	}
+	p.SetPollInterval(interval)
+
+	return p
+}
+
+func (p *Polling) SetPollInterval(interval time.Duration) {
+	p.interval.Store(int64(interval))
+}
+
+func (p *Polling) poll(ctx context.Context) (*client.TrainingTaskResponse, error) {
+	return p.client.GetQueuedTask(ctx)
+}
+
+func (p *Polling) waitInterval() time.Duration {
+	return time.Duration(p.interval.Load())
+}
+
+func (p *Polling) wakeup() <-chan struct{} {
+	return nil
+}
+
+// Events requests queued task when web interface announces it through
+// Server-Sent Events stream. While the stream is disconnected tasks are
+// polled, if web interface does not support the stream at all, it falls back
+// to polling for good.
+type Events struct {
+	client     *client.Client
+	maxBackoff time.Duration
+	wake       chan struct{}
+
+	mu           sync.Mutex
+	connected    bool
+	pollInterval time.Duration
+
+	// state of the stream kept between reconnects, used only by listen
+	lastEventID string
+	retry       time.Duration
+}
+
+// NewEvents creates events task source listening to the stream until ctx is
+// done.
+func NewEvents(ctx context.Context, c *client.Client, pollInterval, maxBackoff time.Duration) *Events {
+	e := &Events{
+		client:       c,
+		pollInterval: pollInterval,
+		maxBackoff:   maxBackoff,
+		wake:         make(chan struct{}, 1),
+	}
+	go e.listen(ctx)
+
+	return e
+}
+
+func (e *Events) poll(ctx context.Context) (*client.TrainingTaskResponse, error) {
+	return e.client.GetQueuedTask(ctx)
+}
+
+func (e *Events) wakeup() <-chan struct{} {
+	return e.wake
+}
+
+func (e *Events) SetPollInterval(interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pollInterval = interval
+}
+
+// waitInterval returns how long to wait before requesting queued task again,
+// events are relied on while the stream is connected.
+func (e *Events) waitInterval() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.connected {
+		return resyncInterval
+	}
+
+	return e.pollInterval
+}
+
+func (e *Events) setConnected(connected bool) {
+	e.mu.Lock()
+	e.connected = connected
+	e.mu.Unlock()
+
+	// tasks queued while connection state changed could be missed
+	e.notify()
+}
+
+func (e *Events) notify() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// listen keeps the events stream open, reconnecting with exponential backoff.
+func (e *Events) listen(ctx context.Context) {
+	bo := backoff.New(time.Second, e.maxBackoff)
+	for ctx.Err() == nil {
+		err := e.consume(ctx, bo)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, client.ErrEventsUnsupported) {
+			log.Printf("Web interface does not support task events, polling every %s", e.waitInterval())
+			return
+		}
+
+		// reconnection delay requested by web interface bounds backoff from
+		// below
+		wait := max(bo.Next(), e.retry)
+		log.Printf("Task events stream disconnected, reconnecting in %s. Error text: %s", wait.Round(time.Millisecond), err.Error())
+		if backoff.Sleep(ctx, wait) != nil {
+			return
+		}
+	}
+}
+
+func (e *Events) consume(ctx context.Context, bo *backoff.Backoff) error {
+	stream, err := e.client.OpenTaskEvents(ctx, e.lastEventID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	defer func() {
+		e.lastEventID = stream.LastEventID()
+		e.retry = stream.Retry()
+	}()
+
+	log.Print("Task events stream connected")
+	bo.Reset()
+	e.setConnected(true)
+	defer e.setConnected(false)
+
+	for {
+		event, err := stream.Next()
+		if err != nil {
+			return err
+		}
+
+		if event.Type == client.TaskEventQueued {
+			log.Printf("Web interface announced queued training task")
+			e.notify()
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package tasksource
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/client"
+)
+
+func TestEventsReconnectWithLastEventID(t *testing.T) {
+	var connections atomic.Int32
+	reconnected := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/training-machines/1/training-tasks/events" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if connections.Add(1) == 1 {
+			io.WriteString(w, "retry: 10\nid: 7\nevent: task-queued\ndata: {}\n\n")
+			return
+		}
+
+		reconnected <- r.Header.Get("Last-Event-ID")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	NewEvents(ctx, client.New(server.URL, 1, "secret"), time.Minute, time.Millisecond)
+
+	select {
+	case lastEventID := <-reconnected:
+		if lastEventID != "7" {
+			t.Errorf("reconnected with Last-Event-ID %q, want %q", lastEventID, "7")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("events stream was not reconnected")
+	}
+}
@@ -0,0 +1,157 @@
+// Package training holds typed configuration of training task, which is
+// written to train.json for pdi scripts.
+package training
+
+//go:generate go run ./schemagen ../../scripts/train_cfg.schema.json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Config mirrors train_default_cfg.json of pdi scripts. Bounds of fields are
+// declared by minimum, maximum, exclusiveMinimum and exclusiveMaximum tags,
+// which are used both for validation and for generated JSON Schema.
+type Config struct {
+	BatchSize         int     `json:"bs" minimum:"1" description:"Batch size"`
+	MaxEpochs         int     `json:"max_epochs" minimum:"1" description:"Maximal number of training epochs"`
+	Dropout           float64 `json:"dropout" minimum:"0" exclusiveMaximum:"1" description:"Dropout probability"`
+	Gamma             float64 `json:"gamma" exclusiveMinimum:"0" maximum:"1" description:"Learning rate decay factor"`
+	Patience          int     `json:"patience" minimum:"0" description:"Number of epochs without improvement before early stopping"`
+	PatienceThreshold float64 `json:"patience_threshold" minimum:"0" description:"Minimal improvement of validation loss resetting patience"`
+	EmbedHidden       int     `json:"embed_hidden" minimum:"1" description:"Hidden size of feature embedding"`
+	DModel            int     `json:"d_model" minimum:"1" description:"Model dimension, must be divisible by num_heads"`
+	FFHidden          int     `json:"ff_hidden" minimum:"1" description:"Hidden size of feed-forward layers"`
+	PoolHidden        int     `json:"pool_hidden" minimum:"1" description:"Hidden size of pooling layer"`
+	NumHeads          int     `json:"num_heads" minimum:"1" description:"Number of attention heads"`
+	NumBlocks         int     `json:"num_blocks" minimum:"1" description:"Number of transformer blocks"`
+	StartLR           float64 `json:"start_lr" exclusiveMinimum:"0" maximum:"1" description:"Initial learning rate"`
+	Undersample       bool    `json:"undersample" description:"Undersample majority classes"`
+}
+
+// Default returns configuration of train_default_cfg.json.
+func Default() Config {
+	return Config{
+		BatchSize:         512,
+		MaxEpochs:         40,
+		Dropout:           0.1,
+		Gamma:             0.9,
+		Patience:          5,
+		PatienceThreshold: 0.001,
+		EmbedHidden:       128,
+		DModel:            32,
+		FFHidden:          128,
+		PoolHidden:        64,
+		NumHeads:          2,
+		NumBlocks:         2,
+		StartLR:           2e-4,
+		Undersample:       false,
+	}
+}
+
+// Parse reads configuration of training task. Missing fields get default
+// values, unknown fields and values out of range are reported together.
+func Parse(data []byte) (*Config, error) {
+	cfg := Default()
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && !bytes.Equal(data, []byte("null")) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid training configuration: %w", err)
+		}
+		if decoder.Decode(&struct{}{}) != io.EOF {
+			return nil, fmt.Errorf("invalid training configuration: unexpected data after JSON object")
+		}
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid training configuration: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks bounds of all fields and relations between them.
+func (c *Config) Validate() error {
+	var errs []error
+
+	value := reflect.ValueOf(c).Elem()
+	for _, field := range reflect.VisibleFields(value.Type()) {
+		fieldValue := value.FieldByIndex(field.Index)
+		if !fieldValue.CanInt() && !fieldValue.CanFloat() {
+			continue
+		}
+
+		var number float64
+		if fieldValue.CanInt() {
+			number = float64(fieldValue.Int())
+		} else {
+			number = fieldValue.Float()
+		}
+
+		b := boundsOf(field)
+		name := jsonName(field)
+		switch {
+		case b.minimum != nil && number < *b.minimum:
+			errs = append(errs, fmt.Errorf("%s must be at least %v, got %v", name, *b.minimum, number))
+		case b.exclusiveMinimum != nil && number <= *b.exclusiveMinimum:
+			errs = append(errs, fmt.Errorf("%s must be greater than %v, got %v", name, *b.exclusiveMinimum, number))
+		case b.maximum != nil && number > *b.maximum:
+			errs = append(errs, fmt.Errorf("%s must be at most %v, got %v", name, *b.maximum, number))
+		case b.exclusiveMaximum != nil && number >= *b.exclusiveMaximum:
+			errs = append(errs, fmt.Errorf("%s must be less than %v, got %v", name, *b.exclusiveMaximum, number))
+		}
+	}
+
+	if c.NumHeads > 0 && c.DModel%c.NumHeads != 0 {
+		errs = append(errs, fmt.Errorf("d_model (%d) must be divisible by num_heads (%d)", c.DModel, c.NumHeads))
+	}
+
+	return errors.Join(errs...)
+}
+
+// bounds are numeric constraints of a field declared by its tags.
+type bounds struct {
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+}
+
+func boundsOf(field reflect.StructField) bounds {
+	return bounds{
+		minimum:          floatTag(field, "minimum"),
+		maximum:          floatTag(field, "maximum"),
+		exclusiveMinimum: floatTag(field, "exclusiveMinimum"),
+		exclusiveMaximum: floatTag(field, "exclusiveMaximum"),
+	}
+}
+
+func floatTag(field reflect.StructField, key string) *float64 {
+	tag, ok := field.Tag.Lookup(key)
+	if !ok {
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(tag, 64)
+	if err != nil {
+		panic(fmt.Sprintf("training: malformed %s tag of %s: %s", key, field.Name, err))
+	}
+
+	return &value
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
@@ -0,0 +1,84 @@
+package training
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	defaults := Default()
+	tests := []struct {
+		name string
+		data string
+		// want is expected configuration, errors are expected if it is nil
+		want *Config
+		// wantErrs are parts expected in error message
+		wantErrs []string
+	}{
+		{"empty", "", &defaults, nil},
+		{"null", "null", &defaults, nil},
+		{"empty object", "{}", &defaults, nil},
+		{"partial", `{"bs": 64, "undersample": true}`, withDefaults(func(c *Config) {
+			c.BatchSize = 64
+			c.Undersample = true
+		}), nil},
+		{"bounds inclusive", `{"dropout": 0, "gamma": 1, "patience": 0, "start_lr": 1}`, withDefaults(func(c *Config) {
+			c.Dropout = 0
+			c.Gamma = 1
+			c.Patience = 0
+			c.StartLR = 1
+		}), nil},
+		{"unknown key", `{"bs": 64, "learning_rate": 0.1}`, nil, []string{`unknown field "learning_rate"`}},
+		{"wrong type", `{"bs": "64"}`, nil, []string{"invalid training configuration"}},
+		{"trailing data", `{"bs": 64} {}`, nil, []string{"unexpected data after JSON object"}},
+		{"below minimum", `{"bs": 0}`, nil, []string{"bs must be at least 1, got 0"}},
+		{"at exclusive maximum", `{"dropout": 1}`, nil, []string{"dropout must be less than 1, got 1"}},
+		{"at exclusive minimum", `{"gamma": 0}`, nil, []string{"gamma must be greater than 0, got 0"}},
+		{"above maximum", `{"start_lr": 1.5}`, nil, []string{"start_lr must be at most 1, got 1.5"}},
+		{"d_model not divisible", `{"d_model": 30, "num_heads": 4}`, nil, []string{"d_model (30) must be divisible by num_heads (4)"}},
+		{"all errors reported", `{"bs": -1, "max_epochs": 0, "d_model": 3}`, nil, []string{
+			"bs must be at least 1, got -1",
+			"max_epochs must be at least 1, got 0",
+			"d_model (3) must be divisible by num_heads (2)",
+		}},
+		{"zero num_heads", `{"num_heads": 0}`, nil, []string{"num_heads must be at least 1, got 0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(test.data))
+			if test.want != nil {
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				if *cfg != *test.want {
+					t.Errorf("Parse = %+v, want %+v", *cfg, *test.want)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Parse = %+v, want error", *cfg)
+			}
+			for _, wantErr := range test.wantErrs {
+				if !strings.Contains(err.Error(), wantErr) {
+					t.Errorf("Parse error = %q, want it to contain %q", err.Error(), wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	cfg := Default()
+	err := cfg.Validate()
+	if err != nil {
+		t.Errorf("Validate of default configuration: %v", err)
+	}
+}
+
+func withDefaults(modify func(c *Config)) *Config {
+	cfg := Default()
+	modify(&cfg)
+	return &cfg
+}
@@ -0,0 +1,59 @@
+package training
+
+import (
+	"reflect"
+)
+
+// Schema returns JSON Schema of training configuration generated from tags
+// of Config, with defaults of Default.
+func Schema() map[string]interface{} {
+	defaults := reflect.ValueOf(Default())
+	properties := make(map[string]interface{})
+
+	for _, field := range reflect.VisibleFields(defaults.Type()) {
+		property := map[string]interface{}{
+			"type":    schemaType(field.Type),
+			"default": defaults.FieldByIndex(field.Index).Interface(),
+		}
+		if description, ok := field.Tag.Lookup("description"); ok {
+			property["description"] = description
+		}
+
+		b := boundsOf(field)
+		for key, value := range map[string]*float64{
+			"minimum":          b.minimum,
+			"maximum":          b.maximum,
+			"exclusiveMinimum": b.exclusiveMinimum,
+			"exclusiveMaximum": b.exclusiveMaximum,
+		} {
+			if value != nil {
+				property[key] = *value
+			}
+		}
+
+		properties[jsonName(field)] = property
+	}
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "AliceTraINT training configuration",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func schemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	}
+
+	return "object"
+}
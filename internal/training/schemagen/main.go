@@ -0,0 +1,27 @@
+// Command schemagen writes JSON Schema of training configuration to file
+// given as the only argument.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/mytkom/AliceTraINT_pidml_training_module/internal/training"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: schemagen <output file>")
+	}
+
+	data, err := json.MarshalIndent(training.Schema(), "", "  ")
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = os.WriteFile(os.Args[1], append(data, '\n'), 0o644)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}